@@ -0,0 +1,207 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/nitrictech/go-sdk/api/documents"
+)
+
+// instanceID identifies this process's chains, so instances running concurrently never fork each other's
+var instanceID = uuid.New().String()
+
+// ComputeHash returns the hex sha256 of every field of the fact except Hash.
+// Instance is only covered when it is set, so facts recorded before it existed still verify.
+func (f *Fact) ComputeHash() string {
+	fields := []interface{}{
+		f.ID, f.Occured, f.Timestamp, f.Sequence, f.Source, f.Action, f.Data, f.PrevHash,
+	}
+
+	if f.Instance != "" {
+		fields = append(fields, f.Instance)
+	}
+
+	b, _ := json.Marshal(fields)
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+type link struct {
+	sequence int64
+	hash     string
+}
+
+// chain links each new fact to the last fact written from the same source by this instance.
+// Every instance starts a new chain for each source, as the heads are only held in memory, so
+// instances running concurrently don't fork each other's chains and no history is read on a cold start.
+type chain struct {
+	mu      sync.Mutex
+	sources map[string]*sourceChain
+}
+
+// sourceChain is the head of one source's chain, locked while a fact is linked and written.
+// The zero head starts the chain.
+type sourceChain struct {
+	mu   sync.Mutex
+	head link
+}
+
+var chains = &chain{sources: map[string]*sourceChain{}}
+
+func (c *chain) source(name string) *sourceChain {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sc, ok := c.sources[name]
+	if !ok {
+		sc = &sourceChain{}
+		c.sources[name] = sc
+	}
+
+	return sc
+}
+
+// append links the fact to the head of its source's chain and writes it. The head only moves on once
+// the write succeeds, so a fact which is never written leaves no gap, and facts from the same source
+// are written one at a time.
+func (c *chain) append(ctx context.Context, col documents.CollectionRef, policy RetryPolicy, fact *Fact) error {
+	sc := c.source(fact.Source)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	fact.Sequence = sc.head.sequence + 1
+	fact.PrevHash = sc.head.hash
+	fact.Hash = fact.ComputeHash()
+
+	if err := writeFact(ctx, col, policy, fact); err != nil {
+		return err
+	}
+
+	sc.head = link{sequence: fact.Sequence, hash: fact.Hash}
+
+	return nil
+}
+
+// kinds of ChainIssue
+const (
+	ChainModified  = "modified"
+	ChainGap       = "gap"
+	ChainFork      = "fork"
+	ChainUnchained = "unchained"
+)
+
+type ChainIssue struct {
+	Source   string `json:"source"`
+	Instance string `json:"instance,omitempty"`
+	ID       string `json:"id"`
+	Sequence int64  `json:"sequence"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+}
+
+type ChainSummary struct {
+	Source   string `json:"source"`
+	Instance string `json:"instance,omitempty"`
+	Facts    int    `json:"facts"`
+	First    int64  `json:"first"`
+	Last     int64  `json:"last"`
+}
+
+// ChainReport summarises each chain keyed by ChainKey
+type ChainReport struct {
+	OK     bool                     `json:"ok"`
+	Chains map[string]*ChainSummary `json:"chains"`
+	Issues []ChainIssue             `json:"issues"`
+}
+
+// ChainKey names the chain of facts from a source recorded by an instance,
+// facts recorded before chains were kept per instance are chained by source alone
+func ChainKey(source, instance string) string {
+	if instance == "" {
+		return source
+	}
+
+	return source + "/" + instance
+}
+
+// VerifyChain walks each chain, the facts from a source recorded by one instance, in sequence order, reporting facts
+// whose content no longer matches their hash, facts missing from the chain and forks where two facts share a predecessor.
+// The oldest remaining fact of each chain is treated as its start, as retention prunes from there,
+// so facts deleted from the start or the end of a chain can't be detected, only those deleted from its middle.
+func VerifyChain(facts []Fact) *ChainReport {
+	report := &ChainReport{OK: true, Chains: map[string]*ChainSummary{}, Issues: []ChainIssue{}}
+
+	byChain := map[string][]Fact{}
+	for _, f := range facts {
+		key := ChainKey(f.Source, f.Instance)
+		byChain[key] = append(byChain[key], f)
+	}
+
+	issue := func(f *Fact, kind, detail string) {
+		report.OK = false
+		report.Issues = append(report.Issues, ChainIssue{
+			Source:   f.Source,
+			Instance: f.Instance,
+			ID:       f.ID,
+			Sequence: f.Sequence,
+			Kind:     kind,
+			Detail:   detail,
+		})
+	}
+
+	for key, sf := range byChain {
+		sort.SliceStable(sf, func(i, j int) bool {
+			if sf[i].Sequence != sf[j].Sequence {
+				return sf[i].Sequence < sf[j].Sequence
+			}
+
+			return sf[i].ID < sf[j].ID
+		})
+
+		summary := &ChainSummary{Source: sf[0].Source, Instance: sf[0].Instance, Facts: len(sf)}
+		report.Chains[key] = summary
+
+		var prev *Fact
+
+		for i := range sf {
+			f := &sf[i]
+
+			if f.Hash == "" {
+				issue(f, ChainUnchained, "fact has no hash")
+				continue
+			}
+
+			if summary.First == 0 {
+				summary.First = f.Sequence
+			}
+
+			summary.Last = f.Sequence
+
+			if h := f.ComputeHash(); h != f.Hash {
+				issue(f, ChainModified, fmt.Sprintf("content hashes to %s, recorded %s", h, f.Hash))
+			}
+
+			if prev != nil {
+				switch {
+				case f.Sequence == prev.Sequence:
+					issue(f, ChainFork, fmt.Sprintf("sequence %d is shared with %s", f.Sequence, prev.ID))
+				case f.PrevHash != prev.Hash || f.Sequence != prev.Sequence+1:
+					issue(f, ChainGap, fmt.Sprintf("previous fact in the chain is %s at sequence %d", prev.ID, prev.Sequence))
+				}
+			}
+
+			prev = f
+		}
+	}
+
+	return report
+}
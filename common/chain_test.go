@@ -0,0 +1,138 @@
+package common_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+	"github.com/nitrictech/test-app/internal/docstest"
+)
+
+func TestChainFailedWriteLeavesNoGap(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	history := srv.Collection("history")
+
+	// the chain heads outlive the test's documents service, so each run uses its own source
+	source := "chain-gap-" + uuid.New().String()
+
+	g.Expect(common.RecordFactWithRetry(ctx, history, common.NoRetry, source, "a", "1")).To(Succeed())
+
+	srv.SetHook(func(op, collection, id string) error {
+		if op == "set" {
+			return errors.New("unavailable")
+		}
+
+		return nil
+	})
+	g.Expect(common.RecordFactWithRetry(ctx, history, common.NoRetry, source, "b", "2")).ToNot(Succeed())
+	srv.SetHook(nil)
+
+	g.Expect(common.RecordFactWithRetry(ctx, history, common.NoRetry, source, "c", "3")).To(Succeed())
+
+	facts, err := common.ReadFacts(ctx, history.Query())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(facts).To(HaveLen(2))
+
+	report := common.VerifyChain(facts)
+	g.Expect(report.Issues).To(BeEmpty())
+	g.Expect(report.Chains[common.ChainKey(source, facts[0].Instance)].Last).To(BeEquivalentTo(2))
+}
+
+// linked returns facts chained in order from the source by the instance
+func linked(source, instance string, n int) []common.Fact {
+	facts := []common.Fact{}
+	prev := ""
+
+	for i := 1; i <= n; i++ {
+		f := common.Fact{
+			ID:       fmt.Sprintf("%s-%s-%d", source, instance, i),
+			Sequence: int64(i),
+			Source:   source,
+			Action:   "recorded",
+			PrevHash: prev,
+			Instance: instance,
+		}
+		f.Hash = f.ComputeHash()
+		prev = f.Hash
+
+		facts = append(facts, f)
+	}
+
+	return facts
+}
+
+func TestVerifyChainPerInstance(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// two instances recording from the same source at once, and facts recorded before instances were chained
+	facts := append(linked("send", "a", 3), linked("send", "b", 2)...)
+	facts = append(facts, linked("send", "", 2)...)
+
+	report := common.VerifyChain(facts)
+	g.Expect(report.Issues).To(BeEmpty())
+	g.Expect(report.Chains).To(HaveLen(3))
+	g.Expect(report.Chains[common.ChainKey("send", "a")].Last).To(BeEquivalentTo(3))
+	g.Expect(report.Chains[common.ChainKey("send", "b")].Instance).To(Equal("b"))
+	g.Expect(report.Chains["send"].Facts).To(Equal(2))
+
+	// deleting from the middle of one instance's chain is still a gap
+	gapped := append(linked("send", "a", 3)[:1], linked("send", "a", 3)[2])
+	report = common.VerifyChain(append(gapped, linked("send", "b", 2)...))
+	g.Expect(report.OK).To(BeFalse())
+	g.Expect(report.Issues).To(HaveLen(1))
+	g.Expect(report.Issues[0].Kind).To(Equal(common.ChainGap))
+	g.Expect(report.Issues[0].Instance).To(Equal("a"))
+
+	// changing which instance recorded a fact breaks its hash
+	moved := linked("send", "a", 2)
+	moved[1].Instance = "b"
+	report = common.VerifyChain(moved)
+	g.Expect(report.Issues).ToNot(BeEmpty())
+	g.Expect(report.Issues[0].Kind).To(Equal(common.ChainModified))
+}
+
+func TestChainRecorderKeepsRecordOrder(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	history := srv.Collection("history")
+
+	recorder := common.NewFactRecorder(history, common.WithBatchSize(0), common.WithFlushParallelism(4))
+
+	ids := map[string]string{}
+	run := uuid.New().String()
+
+	for _, data := range []string{"1", "2", "3", "4", "5"} {
+		for _, source := range []string{"chain-order-a-" + run, "chain-order-b-" + run} {
+			fact, err := recorder.Record(ctx, source, "recorded", data)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			ids[fact.ID] = data
+		}
+	}
+
+	g.Expect(recorder.Close(ctx)).To(Succeed())
+	g.Expect(recorder.Close(ctx)).To(Succeed())
+
+	_, err := recorder.Record(ctx, "chain-order-a-"+run, "recorded", "6")
+	g.Expect(err).To(MatchError(common.ErrRecorderClosed))
+
+	facts, err := common.ReadFacts(ctx, history.Query())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(facts).To(HaveLen(10))
+	g.Expect(common.VerifyChain(facts).OK).To(BeTrue())
+
+	for _, f := range facts {
+		g.Expect(f.Data).To(Equal(ids[f.ID]))
+		g.Expect(f.Sequence).To(BeEquivalentTo(int(f.Data[0] - '0')))
+	}
+}
@@ -0,0 +1,380 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// embedded zoneinfo, function images don't always include it
+	_ "time/tzdata"
+)
+
+// cronField describes one of the five fields of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+	// names of the values, indexed from min
+	names []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{
+		"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December",
+	}},
+	// 0 and 7 are both Sunday
+	{name: "day-of-week", min: 0, max: 7, names: []string{
+		"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday",
+	}},
+}
+
+// Cron is a parsed standard 5-field cron expression, "minute hour day-of-month month day-of-week",
+// evaluated in a timezone
+type Cron struct {
+	expr   string
+	fields []string
+	loc    *time.Location
+
+	minute, hour, dom, month, dow uint64
+}
+
+// ParseCron parses a 5-field cron expression, in the IANA timezone, UTC if empty.
+// Fields accept *, values, ranges (1-5), steps (*/15, 0-30/10), lists (1,15) and
+// three letter month and day names.
+func ParseCron(expr, timezone string) (*Cron, error) {
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %s; %w", timezone, err)
+		}
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q, must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, f := range fields {
+		var err error
+		if bits[i], err = cronFields[i].parse(f); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q; %w", expr, err)
+		}
+	}
+
+	// fold Sunday as 7 into 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Cron{
+		expr:   expr,
+		fields: fields,
+		loc:    loc,
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+	}, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if len(s) == 3 && strings.EqualFold(s, name[:3]) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s value %s must be between %d and %d", f.name, s, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+// parse returns the set of values matched by the field expression as a bitset
+func (f cronField) parse(expr string) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("%s step %s must be a positive integer", f.name, part[i+1:])
+			}
+		}
+
+		lo, hi := f.min, f.max
+
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+
+			// a day-of-week range can end on Sunday as 0, e.g. MON-SUN
+			if f.max == 7 && hi == 0 && lo > 0 {
+				hi = 7
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("%s range %s must be ascending", f.name, rng)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+
+			// a single value with a step, e.g. 5/15, runs from the value to the end of the range
+			if step == 1 {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Location is the timezone the expression is evaluated in
+func (c *Cron) Location() *time.Location {
+	return c.loc
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// unrestricted reports whether a field starts with *, which cron treats as unrestricted even with a step, e.g. */2
+func unrestricted(field string) bool {
+	return strings.HasPrefix(field, "*")
+}
+
+// dayMatches follows cron in matching either day field when both are restricted
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := has(c.dom, t.Day())
+	dow := has(c.dow, int(t.Weekday()))
+
+	if unrestricted(c.fields[2]) || unrestricted(c.fields[4]) {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// repeated reports whether the wall time of t already happened earlier, in the hour (or so) repeated when
+// clocks go back for DST
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-2 * time.Hour).Zone()
+
+	if before <= offset {
+		return false
+	}
+
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() && earlier.Day() == t.Day()
+}
+
+// Next returns the first time after the given time matched by the expression,
+// or the zero time if there isn't one in the next five years.
+// Like cron, a wall time repeated when clocks go back for DST only runs once, unless the hour is a wildcard
+// (e.g. * or */2), and wall times skipped when clocks go forward don't run.
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	// advance to the start of the next month, day or hour when a field doesn't match,
+	// stepping forward by an hour where a DST transition would otherwise repeat one
+	advance := func(next time.Time) time.Time {
+		if !next.After(t) {
+			return t.Add(time.Hour).Truncate(time.Hour)
+		}
+
+		return next
+	}
+
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = advance(time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc))
+		case !c.dayMatches(t):
+			t = advance(time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc))
+		case !has(c.hour, t.Hour()):
+			t = advance(time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc))
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		case !unrestricted(c.fields[1]) && repeated(t):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// NextN returns the next n times after the given time matched by the expression
+func (c *Cron) NextN(after time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+
+	for len(times) < n {
+		next := c.Next(after)
+		if next.IsZero() {
+			break
+		}
+
+		times = append(times, next)
+		after = next
+	}
+
+	return times
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+
+	return strconv.Itoa(n) + suffix
+}
+
+// describeValue names a value, prefixing plain numbers with the field name when prefix is set
+func (f cronField) describeValue(s string, prefix bool) string {
+	v, err := f.value(s)
+	if err != nil {
+		return s
+	}
+
+	if f.names != nil {
+		return f.names[v-f.min]
+	}
+
+	if prefix {
+		return f.name + " " + strconv.Itoa(v)
+	}
+
+	return strconv.Itoa(v)
+}
+
+func (f cronField) describePart(part string) string {
+	rng, step := part, ""
+	if i := strings.Index(part, "/"); i >= 0 {
+		rng, step = part[:i], part[i+1:]
+	}
+
+	every := "every " + f.name
+	if n, err := strconv.Atoi(step); err == nil && n > 1 {
+		every = "every " + ordinal(n) + " " + f.name
+	}
+
+	switch {
+	case rng == "*":
+		return every
+	case strings.Contains(rng, "-"):
+		bounds := strings.SplitN(rng, "-", 2)
+		through := f.describeValue(bounds[0], true) + " through " + f.describeValue(bounds[1], false)
+
+		if step != "" {
+			return every + " from " + f.describeValue(bounds[0], false) + " through " + f.describeValue(bounds[1], false)
+		}
+
+		return through
+	case step != "":
+		return every + " from " + f.describeValue(rng, false)
+	default:
+		return f.describeValue(rng, true)
+	}
+}
+
+func (f cronField) describe(expr string) string {
+	parts := strings.Split(expr, ",")
+	descs := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		descs = append(descs, f.describePart(part))
+	}
+
+	if len(descs) == 1 {
+		return descs[0]
+	}
+
+	return strings.Join(descs[:len(descs)-1], ", ") + " and " + descs[len(descs)-1]
+}
+
+// Describe returns an english description of when the expression runs, e.g. "At 09:00 on Monday through Friday"
+func (c *Cron) Describe() string {
+	minute, hour, dom, month, dow := c.fields[0], c.fields[1], c.fields[2], c.fields[3], c.fields[4]
+
+	var desc string
+
+	m, mErr := strconv.Atoi(minute)
+	h, hErr := strconv.Atoi(hour)
+
+	if mErr == nil && hErr == nil {
+		desc = fmt.Sprintf("At %02d:%02d", h, m)
+	} else {
+		desc = "At " + cronFields[0].describe(minute)
+		if hour != "*" {
+			desc += " past " + cronFields[1].describe(hour)
+		}
+	}
+
+	if dom != "*" {
+		desc += " on " + cronFields[2].describe(dom)
+	}
+
+	if dow != "*" {
+		switch {
+		case dom == "*":
+		case unrestricted(dom) || unrestricted(dow):
+			desc += " and"
+		default:
+			desc += " or"
+		}
+
+		desc += " on " + cronFields[4].describe(dow)
+	}
+
+	if month != "*" {
+		desc += " in " + cronFields[3].describe(month)
+	}
+
+	return desc
+}
@@ -0,0 +1,192 @@
+package common_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr     string
+		timezone string
+		err      string
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * MON-FRI", timezone: "Europe/London"},
+		{expr: "0 0 1,15 * *"},
+		{expr: "5/10 * * jan-jun *"},
+		{expr: "0 12 * * MON-SUN"},
+		{expr: "0 12 * * 1-0"},
+		{expr: "0 12 * * 7"},
+		{expr: "* * * *", err: "must have 5 fields"},
+		{expr: "60 * * * *", err: "minute value 60 must be between 0 and 59"},
+		{expr: "* 24 * * *", err: "hour value 24"},
+		{expr: "* * 0 * *", err: "day-of-month value 0"},
+		{expr: "* * * 13 *", err: "month value 13"},
+		{expr: "* * * * 8", err: "day-of-week value 8"},
+		{expr: "*/0 * * * *", err: "minute step 0 must be a positive integer"},
+		{expr: "30-10 * * * *", err: "minute range 30-10 must be ascending"},
+		{expr: "* * * * FRI-MON", err: "must be ascending"},
+		{expr: "* * * * *", timezone: "Mars/Olympus", err: "invalid timezone Mars/Olympus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr+" "+tt.timezone, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			_, err := common.ParseCron(tt.expr, tt.timezone)
+			if tt.err == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.err)))
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		timezone string
+		after    string
+		want     []string
+	}{
+		{
+			name:  "every minute",
+			expr:  "* * * * *",
+			after: "2026-01-01T00:00:30Z",
+			want:  []string{"2026-01-01T00:01:00Z", "2026-01-01T00:02:00Z"},
+		},
+		{
+			name:  "steps within an hour range",
+			expr:  "*/20 9-10 * * *",
+			after: "2026-01-01T10:30:00Z",
+			want:  []string{"2026-01-01T10:40:00Z", "2026-01-02T09:00:00Z", "2026-01-02T09:20:00Z"},
+		},
+		{
+			name:  "weekdays skip the weekend",
+			expr:  "0 9 * * MON-FRI",
+			after: "2026-01-02T09:00:00Z",
+			want:  []string{"2026-01-05T09:00:00Z"},
+		},
+		{
+			name:  "monday through sunday is every day",
+			expr:  "0 9 * * MON-SUN",
+			after: "2026-01-03T09:00:00Z",
+			want:  []string{"2026-01-04T09:00:00Z", "2026-01-05T09:00:00Z"},
+		},
+		{
+			name:  "both days restricted match either",
+			expr:  "0 0 13 * FRI",
+			after: "2026-02-01T00:00:00Z",
+			want:  []string{"2026-02-06T00:00:00Z", "2026-02-13T00:00:00Z", "2026-02-20T00:00:00Z"},
+		},
+		{
+			name:  "a stepped day of month is unrestricted, so both days must match",
+			expr:  "0 0 */2 * MON",
+			after: "2026-01-01T00:00:00Z",
+			want:  []string{"2026-01-05T00:00:00Z", "2026-01-19T00:00:00Z", "2026-02-09T00:00:00Z"},
+		},
+		{
+			name:  "leap day",
+			expr:  "0 0 29 2 *",
+			after: "2026-01-01T00:00:00Z",
+			want:  []string{"2028-02-29T00:00:00Z"},
+		},
+		{
+			name:     "in the timezone",
+			expr:     "0 9 * * *",
+			timezone: "Europe/London",
+			after:    "2026-07-01T00:00:00Z",
+			want:     []string{"2026-07-01T08:00:00Z"},
+		},
+		{
+			name:     "repeated wall time when clocks go back runs once",
+			expr:     "30 1 * * *",
+			timezone: "America/New_York",
+			after:    "2026-10-31T12:00:00Z",
+			want:     []string{"2026-11-01T05:30:00Z", "2026-11-02T06:30:00Z"},
+		},
+		{
+			name:     "wildcard hours keep running through the repeated hour",
+			expr:     "30 * * * *",
+			timezone: "America/New_York",
+			after:    "2026-11-01T04:00:00Z",
+			want:     []string{"2026-11-01T04:30:00Z", "2026-11-01T05:30:00Z", "2026-11-01T06:30:00Z", "2026-11-01T07:30:00Z"},
+		},
+		{
+			name:     "skipped wall time when clocks go forward doesn't run",
+			expr:     "30 2 * * *",
+			timezone: "America/New_York",
+			after:    "2026-03-07T12:00:00Z",
+			want:     []string{"2026-03-09T06:30:00Z"},
+		},
+		{
+			name:     "times either side of clocks going forward",
+			expr:     "0 1,3 * * *",
+			timezone: "America/New_York",
+			after:    "2026-03-08T00:00:00Z",
+			want:     []string{"2026-03-08T06:00:00Z", "2026-03-08T07:00:00Z"},
+		},
+		{
+			name:  "never",
+			expr:  "0 0 31 2 *",
+			after: "2026-01-01T00:00:00Z",
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			c, err := common.ParseCron(tt.expr, tt.timezone)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			after, err := time.Parse(time.RFC3339, tt.after)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			got := []string{}
+			for _, next := range c.NextN(after, len(tt.want)) {
+				got = append(got, next.UTC().Format(time.RFC3339))
+			}
+
+			g.Expect(got).To(Equal(tt.want))
+
+			if len(tt.want) == 0 {
+				g.Expect(c.Next(after).IsZero()).To(BeTrue())
+			}
+		})
+	}
+}
+
+func TestCronDescribe(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "0 9 * * *", want: "At 09:00"},
+		{expr: "0 9 * * MON-FRI", want: "At 09:00 on Monday through Friday"},
+		{expr: "*/15 9-17 * * *", want: "At every 15th minute past hour 9 through 17"},
+		{expr: "0 0 1,15 * *", want: "At 00:00 on day-of-month 1 and day-of-month 15"},
+		{expr: "0 0 13 * FRI", want: "At 00:00 on day-of-month 13 or on Friday"},
+		{expr: "0 0 */2 * MON", want: "At 00:00 on every 2nd day-of-month and on Monday"},
+		{expr: "30 6 * JAN-MAR *", want: "At 06:30 in January through March"},
+		{expr: "0 12 * * MON-SUN", want: "At 12:00 on Monday through Sunday"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			c, err := common.ParseCron(tt.expr, "")
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(c.Describe()).To(Equal(tt.want))
+		})
+	}
+}
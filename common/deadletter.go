@@ -0,0 +1,40 @@
+package common
+
+// DeadLetter is a queue task or topic event which failed too many times, kept in the work-dlq collection
+// with the reason it failed until it is replayed. The ID of a task is its task ID, the ID of an event
+// is its topic and message ID, e.g. "ping:1234", as message IDs are only unique on their channel.
+type DeadLetter struct {
+	ID string `json:"id"`
+	// MessageID is the ID of the task or event itself, which is replayed with it
+	MessageID string `json:"messageId,omitempty"`
+	Queue     string `json:"queue,omitempty"`
+	// Topic is set instead of Queue for topic events
+	Topic       string                 `json:"topic,omitempty"`
+	PayloadType string                 `json:"payloadType"`
+	Payload     map[string]interface{} `json:"payload"`
+	Reason      string                 `json:"reason"`
+	Attempts    int                    `json:"attempts"`
+	DeadAt      string                 `json:"deadAt"`
+}
+
+// TaskAttempts counts the failed deliveries of a queue task or topic event, kept in the attempts collection
+// with the same ID as its DeadLetter
+type TaskAttempts struct {
+	ID        string `json:"id"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError"`
+}
+
+// ReplayID returns the ID to replay the dead letter with. Dead letters written before MessageID was kept
+// fall back to the ID in their message payload, then to their own ID.
+func (dl *DeadLetter) ReplayID() string {
+	if dl.MessageID != "" {
+		return dl.MessageID
+	}
+
+	if id, ok := dl.Payload["ID"].(string); ok && id != "" {
+		return id
+	}
+
+	return dl.ID
+}
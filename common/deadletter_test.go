@@ -0,0 +1,19 @@
+package common_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func TestDeadLetterReplayID(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect((&common.DeadLetter{ID: "ping:1234", MessageID: "1234", Topic: "ping"}).ReplayID()).To(Equal("1234"))
+
+	// written before the message ID was kept
+	g.Expect((&common.DeadLetter{ID: "ping:1234", Topic: "ping", Payload: map[string]interface{}{"ID": "1234"}}).ReplayID()).To(Equal("1234"))
+	g.Expect((&common.DeadLetter{ID: "5678", Queue: "work"}).ReplayID()).To(Equal("5678"))
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// maxTopicDelay is the longest delay each provider accepts for publishing events,
+// queue delays are handled by staging tasks so only limited by MaxStagedDelay
+var maxTopicDelay = map[string]time.Duration{
+	"aws":   365 * 24 * time.Hour,
+	"gcp":   30 * 24 * time.Hour,
+	"azure": 7 * 24 * time.Hour,
+	"local": 24 * time.Hour,
+}
+
+// MaxStagedDelay is the longest a queue task is held in the staged collection
+const MaxStagedDelay = 30 * 24 * time.Hour
+
+// Provider returns the cloud provider from the PROVIDER environment variable, defaulting to local
+func Provider() string {
+	if p := os.Getenv("PROVIDER"); p != "" {
+		return p
+	}
+
+	return "local"
+}
+
+// MaxDelay returns the longest delivery delay for a message type on the current provider,
+// overridden by a MAX_DELIVERY_DELAY duration.
+func MaxDelay(messageType string) (time.Duration, error) {
+	if v := os.Getenv("MAX_DELIVERY_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MAX_DELIVERY_DELAY: %w", err)
+		}
+
+		if d <= 0 {
+			return 0, fmt.Errorf("invalid MAX_DELIVERY_DELAY %s, must be positive", v)
+		}
+
+		return d, nil
+	}
+
+	if messageType == "queue" {
+		return MaxStagedDelay, nil
+	}
+
+	if d, ok := maxTopicDelay[Provider()]; ok {
+		return d, nil
+	}
+
+	return maxTopicDelay["local"], nil
+}
+
+// StagedTask is a queue task held in the staged collection until it is due
+type StagedTask struct {
+	ID string
+	// Due is when the task should be sent in microseconds since the unix epoch
+	Due         int64
+	PayloadType string
+	Payload     map[string]interface{}
+}
@@ -0,0 +1,46 @@
+package common_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func TestMaxDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    string
+		override    string
+		messageType string
+		want        time.Duration
+		err         string
+	}{
+		{name: "local topic", messageType: "topic", want: 24 * time.Hour},
+		{name: "gcp topic", provider: "gcp", messageType: "topic", want: 30 * 24 * time.Hour},
+		{name: "unknown provider topic", provider: "on-prem", messageType: "topic", want: 24 * time.Hour},
+		{name: "queue", provider: "azure", messageType: "queue", want: common.MaxStagedDelay},
+		{name: "override", provider: "aws", override: "90s", messageType: "queue", want: 90 * time.Second},
+		{name: "invalid override", override: "a week", messageType: "topic", err: "invalid MAX_DELIVERY_DELAY"},
+		{name: "negative override", override: "-1h", messageType: "topic", err: "must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+			t.Setenv("PROVIDER", tt.provider)
+			t.Setenv("MAX_DELIVERY_DELAY", tt.override)
+
+			got, err := common.MaxDelay(tt.messageType)
+			if tt.err != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.err)))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
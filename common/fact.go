@@ -5,40 +5,139 @@ package common
 import (
 	"context"
 	"fmt"
+	"io"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/mitchellh/mapstructure"
 	"github.com/nitrictech/go-sdk/api/documents"
+	"github.com/pkg/errors"
 )
 
 type Fact struct {
 	ID      string `json:"id"`
 	Occured string `json:"occured"`
-	Source  string `json:"source"`
-	Action  string `json:"action"`
-	Data    string `json:"data"`
+	// Timestamp is when the fact occured in microseconds since the unix epoch,
+	// small enough to survive the float64 numbers used by the documents service.
+	Timestamp int64 `json:"timestamp"`
+	// Sequence increases by one for every fact recorded from the same source by the same instance
+	Sequence int64  `json:"sequence"`
+	Source   string `json:"source"`
+	Action   string `json:"action"`
+	Data     string `json:"data"`
+	// PrevHash is the Hash of the previous fact from the same source and instance
+	PrevHash string `json:"prevHash"`
+	// Hash covers every other field, chaining the facts from each source and instance together
+	Hash string `json:"hash"`
+	// Instance identifies the process which recorded the fact, each chaining its facts separately.
+	// It is empty for facts recorded before chains were kept per instance.
+	Instance string `json:"instance,omitempty"`
 }
 
-func RecordFact(ctx context.Context, col documents.CollectionRef, source, action, data string) {
+// Time returns when the fact occured, falling back to Occured for facts recorded before Timestamp existed
+func (f *Fact) Time() time.Time {
+	if f.Timestamp != 0 {
+		return time.UnixMicro(f.Timestamp)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, f.Occured)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// SortFacts orders facts deterministically by time, then source and sequence, then ID
+func SortFacts(facts []Fact) {
+	sort.SliceStable(facts, func(i, j int) bool {
+		a, b := &facts[i], &facts[j]
+
+		if ta, tb := a.Time(), b.Time(); !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+
+		if a.Sequence != b.Sequence {
+			return a.Sequence < b.Sequence
+		}
+
+		return a.ID < b.ID
+	})
+}
+
+// ReadFacts streams every fact matching the query
+func ReadFacts(ctx context.Context, query documents.Query) ([]Fact, error) {
+	iter, err := query.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := []Fact{}
+
+	for {
+		doc, err := iter.Next()
+		if err == io.EOF {
+			return facts, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		f := Fact{}
+		if err := mapstructure.Decode(doc.Content(), &f); err != nil {
+			return nil, errors.WithMessage(err, "error decoding fact document")
+		}
+
+		facts = append(facts, f)
+	}
+}
+
+// RecordFact writes a fact to the collection, retrying with the DefaultRetryPolicy
+func RecordFact(ctx context.Context, col documents.CollectionRef, source, action, data string) error {
+	return RecordFactWithRetry(ctx, col, DefaultRetryPolicy, source, action, data)
+}
+
+// RecordFactWithRetry writes a fact to the collection, retrying failed writes with the given policy
+func RecordFactWithRetry(ctx context.Context, col documents.CollectionRef, policy RetryPolicy, source, action, data string) error {
+	return chains.append(ctx, col, policy, newFact(source, action, data))
+}
+
+// newFact creates an unlinked fact, chains.append links it when it is written
+func newFact(source, action, data string) *Fact {
+	now := time.Now().UTC()
 	fact := &Fact{
-		ID:      uuid.New().String(),
-		Occured: time.Now().Format(time.RFC3339),
-		Source:  source,
-		Action:  action,
-		Data:    data,
+		ID:        uuid.New().String(),
+		Occured:   now.Format(time.RFC3339Nano),
+		Timestamp: now.UnixMicro(),
+		Source:    source,
+		Action:    action,
+		Data:      data,
+		Instance:  instanceID,
 	}
+
+	return fact
+}
+
+func writeFact(ctx context.Context, col documents.CollectionRef, policy RetryPolicy, fact *Fact) error {
 	factMap := make(map[string]interface{})
 	err := mapstructure.Decode(fact, &factMap)
 	if err != nil {
-		fmt.Println("error decoding fact document")
+		return errors.WithMessage(err, "error decoding fact document")
 	}
 
-	fmt.Printf("RecordFact %v", factMap)
+	fmt.Printf("RecordFact %v\n", factMap)
 
-	if err := col.Doc(fact.ID).Set(ctx, factMap); err != nil {
-		fmt.Println("error writing fact to histroy document")
-	}
+	err = policy.Do(ctx, func() error {
+		return col.Doc(fact.ID).Set(ctx, factMap)
+	})
+
+	return errors.WithMessage(err, "error writing fact to history document")
 }
 
 // [END snippet]
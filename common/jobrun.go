@@ -0,0 +1,110 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the jobs the worker can run on a schedule or a manual trigger
+const (
+	JobConsumeQueue    = "consume-queue"
+	JobReleaseStaged   = "release-staged"
+	JobPruneHistory    = "prune-history"
+	JobExpireProcessed = "expire-processed"
+)
+
+// Jobs lists every job the worker can run
+var Jobs = []string{JobConsumeQueue, JobReleaseStaged, JobPruneHistory, JobExpireProcessed}
+
+// KnownJob reports whether the worker can run the job
+func KnownJob(name string) bool {
+	for _, j := range Jobs {
+		if j == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// what started a job run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// ManualSchedule is the schedule recorded for manual runs of a job which isn't scheduled
+const ManualSchedule = "manual"
+
+// JobTrigger is published to the job-trigger topic to run a job on demand, ID becomes the ID of the run.
+// Name is a schedule or a job, resolved by the worker against the schedules it runs.
+type JobTrigger struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Resolve returns the schedule and job the trigger runs: a schedule's own job, recorded against the schedule,
+// or a job recorded against the ManualSchedule
+func (t *JobTrigger) Resolve(schedules []Schedule) (schedule, job string, err error) {
+	for _, s := range schedules {
+		if s.Name == t.Name {
+			return s.Name, s.Job, nil
+		}
+	}
+
+	if KnownJob(t.Name) {
+		return ManualSchedule, t.Name, nil
+	}
+
+	return "", "", fmt.Errorf("unknown schedule or job %s, jobs are [%s]", t.Name, strings.Join(Jobs, ", "))
+}
+
+// job run statuses
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	// JobSkipped runs didn't start, as another run of the job held its lease
+	JobSkipped = "skipped"
+)
+
+// JobRun records one run of a scheduled job in the job-runs collection. Start and End are unix microseconds,
+// so runs can be queried by time, End is zero while the job is running.
+type JobRun struct {
+	ID         string  `json:"id"`
+	Schedule   string  `json:"schedule"`
+	Job        string  `json:"job"`
+	Trigger    string  `json:"trigger"`
+	Status     string  `json:"status"`
+	Start      int64   `json:"start"`
+	End        int64   `json:"end,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+	Received   int     `json:"received"`
+	Completed  int     `json:"completed"`
+	Failed     int     `json:"failed"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Started returns when the job started
+func (r *JobRun) Started() time.Time {
+	return time.UnixMicro(r.Start)
+}
+
+// Finish records the end of the run, and its error if it failed
+func (r *JobRun) Finish(end time.Time, err error) {
+	r.End = end.UnixMicro()
+	r.DurationMs = float64(end.Sub(r.Started())) / float64(time.Millisecond)
+	r.Status = JobSucceeded
+
+	if err != nil {
+		r.Status = JobFailed
+		r.Error = err.Error()
+	}
+}
+
+// Skip records the run didn't start, with the reason why
+func (r *JobRun) Skip(end time.Time, reason error) {
+	r.Finish(end, reason)
+	r.Status = JobSkipped
+}
@@ -0,0 +1,303 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/documents"
+	"github.com/nitrictech/go-sdk/api/errors/codes"
+)
+
+// Lease is a lock document, held by Owner until Expires (unix microseconds) unless it is renewed.
+// Token identifies a single acquisition, so an owner can tell when its lease was taken over.
+type Lease struct {
+	Name     string `json:"name"`
+	Owner    string `json:"owner"`
+	Token    string `json:"token"`
+	Acquired int64  `json:"acquired"`
+	Expires  int64  `json:"expires"`
+}
+
+// ErrLeaseHeld is returned when another owner holds an unexpired lease
+type ErrLeaseHeld struct {
+	Lease Lease
+}
+
+func (e *ErrLeaseHeld) Error() string {
+	return fmt.Sprintf("lease %s is held by %s until %s", e.Lease.Name, e.Lease.Owner, time.UnixMicro(e.Lease.Expires).UTC().Format(time.RFC3339Nano))
+}
+
+// ErrLeaseLost is returned when a held lease was taken over by another owner
+type ErrLeaseLost struct {
+	Name string
+}
+
+func (e *ErrLeaseLost) Error() string {
+	return fmt.Sprintf("lease %s was lost to another owner", e.Name)
+}
+
+// Locker hands out leases kept in a documents collection. A lease expires unless it is renewed, so one held by a
+// crashed owner is taken over once it goes stale.
+//
+// Leases are best-effort rather than strict mutual exclusion. The documents API has no conditional writes, so
+// acquiring a lease writes it, waits for the settle delay and reads it back to check no one else wrote theirs in
+// the meantime, but a write which takes longer than the settle delay to land can still leave two owners both
+// believing they hold the lease. Renew and Release also read before they write, so they can overwrite or delete a
+// lease taken over in between. Held leases are checked again on every renewal, so such an overlap lasts at most a
+// third of the ttl. Jobs run under a lease must tolerate the occasional overlapping run.
+type Locker struct {
+	col    documents.CollectionRef
+	owner  string
+	ttl    time.Duration
+	settle time.Duration
+}
+
+// MinLeaseTTL is the shortest lease a Locker accepts
+const MinLeaseTTL = time.Second
+
+// leaseTTLSettles is how many settle delays a lease must last at least, so it isn't renewed before it is confirmed
+const leaseTTLSettles = 4
+
+type LockerOption func(*Locker)
+
+// WithLeaseTTL sets how long a lease lasts without being renewed, renewals happen every third of it
+func WithLeaseTTL(ttl time.Duration) LockerOption {
+	return func(l *Locker) {
+		l.ttl = ttl
+	}
+}
+
+// WithSettleDelay sets how long to wait before confirming a newly written lease
+func WithSettleDelay(settle time.Duration) LockerOption {
+	return func(l *Locker) {
+		l.settle = settle
+	}
+}
+
+// NewLocker returns a Locker for leases in the collection, owned by the host and process. The ttl must be at least
+// MinLeaseTTL and four times the settle delay.
+func NewLocker(col documents.CollectionRef, opts ...LockerOption) (*Locker, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	l := &Locker{
+		col:    col,
+		owner:  fmt.Sprintf("%s/%d", host, os.Getpid()),
+		ttl:    time.Minute,
+		settle: 250 * time.Millisecond,
+	}
+
+	for _, o := range opts {
+		o(l)
+	}
+
+	if l.settle < 0 {
+		return nil, fmt.Errorf("invalid lease settle delay %s, must not be negative", l.settle)
+	}
+
+	if min := leaseTTLSettles * l.settle; l.ttl < MinLeaseTTL || l.ttl < min {
+		if min < MinLeaseTTL {
+			min = MinLeaseTTL
+		}
+
+		return nil, fmt.Errorf("invalid lease ttl %s, must be at least %s", l.ttl, min)
+	}
+
+	return l, nil
+}
+
+func (l *Locker) read(ctx context.Context, name string) (*Lease, error) {
+	doc, err := l.col.Doc(name).Get(ctx)
+	if ErrorCode(err) == codes.NotFound {
+		// a missing lease is free
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &Lease{}
+	if err := mapstructure.Decode(doc.Content(), lease); err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (l *Locker) write(ctx context.Context, lease *Lease) error {
+	leaseMap := make(map[string]interface{})
+	if err := mapstructure.Decode(lease, &leaseMap); err != nil {
+		return err
+	}
+
+	return l.col.Doc(lease.Name).Set(ctx, leaseMap)
+}
+
+// HeldLease is a lease acquired by a Locker
+type HeldLease struct {
+	locker *Locker
+	lease  Lease
+	mu     sync.Mutex
+}
+
+// Acquire takes the named lease if it is free or has expired, otherwise returning an *ErrLeaseHeld
+func (l *Locker) Acquire(ctx context.Context, name string) (*HeldLease, error) {
+	now := time.Now()
+
+	current, err := l.read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil && current.Expires > now.UnixMicro() {
+		return nil, &ErrLeaseHeld{Lease: *current}
+	}
+
+	if current != nil {
+		fmt.Printf("taking over stale lease %s from %s\n", name, current.Owner)
+	}
+
+	lease := Lease{
+		Name:     name,
+		Owner:    l.owner,
+		Token:    uuid.New().String(),
+		Acquired: now.UnixMicro(),
+		Expires:  now.Add(l.ttl).UnixMicro(),
+	}
+
+	if err := l.write(ctx, &lease); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(l.settle):
+	}
+
+	confirmed, err := l.read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirmed == nil || confirmed.Token != lease.Token {
+		if confirmed != nil {
+			return nil, &ErrLeaseHeld{Lease: *confirmed}
+		}
+
+		return nil, &ErrLeaseLost{Name: name}
+	}
+
+	return &HeldLease{locker: l, lease: lease}, nil
+}
+
+// Lease returns the lease as it was last written
+func (h *HeldLease) Lease() Lease {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.lease
+}
+
+// Renew extends the lease by the ttl, returning an *ErrLeaseLost if it was taken over.
+// A takeover between the read and the write is overwritten, see Locker.
+func (h *HeldLease) Renew(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current, err := h.locker.read(ctx, h.lease.Name)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.Token != h.lease.Token {
+		return &ErrLeaseLost{Name: h.lease.Name}
+	}
+
+	lease := h.lease
+	lease.Expires = time.Now().Add(h.locker.ttl).UnixMicro()
+
+	if err := h.locker.write(ctx, &lease); err != nil {
+		return err
+	}
+
+	h.lease = lease
+
+	return nil
+}
+
+// Release deletes the lease, unless it was taken over by another owner.
+// A takeover between the read and the delete is deleted, see Locker.
+func (h *HeldLease) Release(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current, err := h.locker.read(ctx, h.lease.Name)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.Token != h.lease.Token {
+		return nil
+	}
+
+	return h.locker.col.Doc(h.lease.Name).Delete(ctx)
+}
+
+// WithLease runs fn holding the named lease, renewing it in the background. The context passed to fn is
+// cancelled if the lease is lost, and the lease is released once fn returns. Returns an *ErrLeaseHeld
+// without running fn when another owner holds the lease.
+func (l *Locker) WithLease(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	held, err := l.Acquire(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+
+	go func() {
+		defer close(renewed)
+
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := held.Renew(ctx); err != nil {
+					fmt.Printf("error renewing lease %s: %v\n", name, err)
+
+					if _, lost := err.(*ErrLeaseLost); lost {
+						cancel()
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	err = fn(fnCtx)
+
+	close(done)
+	<-renewed
+
+	if releaseErr := held.Release(ctx); releaseErr != nil {
+		fmt.Printf("error releasing lease %s: %v\n", name, releaseErr)
+	}
+
+	return err
+}
@@ -0,0 +1,168 @@
+package common_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+	"github.com/nitrictech/test-app/internal/docstest"
+)
+
+func newTestLocker(t *testing.T, srv *docstest.Server, opts ...common.LockerOption) *common.Locker {
+	t.Helper()
+
+	opts = append([]common.LockerOption{common.WithSettleDelay(20 * time.Millisecond)}, opts...)
+
+	l, err := common.NewLocker(srv.Collection("locks"), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestLockerTTLValidation(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	srv := docstest.Start(t)
+
+	_, err := common.NewLocker(srv.Collection("locks"), common.WithLeaseTTL(2*time.Nanosecond))
+	g.Expect(err).To(MatchError(ContainSubstring("must be at least 1s")))
+
+	_, err = common.NewLocker(srv.Collection("locks"), common.WithLeaseTTL(2*time.Second), common.WithSettleDelay(time.Second))
+	g.Expect(err).To(MatchError(ContainSubstring("must be at least 4s")))
+
+	_, err = common.NewLocker(srv.Collection("locks"), common.WithLeaseTTL(time.Second))
+	g.Expect(err).ToNot(HaveOccurred())
+}
+
+func TestLockerContenders(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	a := newTestLocker(t, srv)
+	b := newTestLocker(t, srv)
+
+	held, err := a.Acquire(ctx, "contended")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = b.Acquire(ctx, "contended")
+
+	var heldErr *common.ErrLeaseHeld
+	g.Expect(errors.As(err, &heldErr)).To(BeTrue())
+	g.Expect(heldErr.Lease.Token).To(Equal(held.Lease().Token))
+
+	g.Expect(held.Release(ctx)).To(Succeed())
+
+	_, err = b.Acquire(ctx, "contended")
+	g.Expect(err).ToNot(HaveOccurred())
+}
+
+func TestLockerConcurrentAcquireHasOneWinner(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	lockers := []*common.Locker{newTestLocker(t, srv), newTestLocker(t, srv), newTestLocker(t, srv)}
+
+	errs := make([]error, len(lockers))
+	wg := sync.WaitGroup{}
+
+	for i, l := range lockers {
+		wg.Add(1)
+
+		go func(i int, l *common.Locker) {
+			defer wg.Done()
+
+			_, errs[i] = l.Acquire(ctx, "race")
+		}(i, l)
+	}
+
+	wg.Wait()
+
+	winners := 0
+	for _, err := range errs {
+		if err == nil {
+			winners++
+		}
+	}
+
+	g.Expect(winners).To(Equal(1))
+}
+
+func TestLockerTakesOverExpiredLease(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	l := newTestLocker(t, srv)
+
+	expired := time.Now().Add(-time.Second).UnixMicro()
+	g.Expect(srv.Put("locks", "stale", map[string]interface{}{
+		"Name": "stale", "Owner": "crashed/1", "Token": "crashed", "Acquired": expired, "Expires": expired,
+	})).To(Succeed())
+
+	held, err := l.Acquire(ctx, "stale")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(held.Lease().Token).ToNot(Equal("crashed"))
+	g.Expect(srv.Docs("locks")["stale"]["Token"]).To(Equal(held.Lease().Token))
+}
+
+func TestLockerWithLeaseSkipsWhenHeld(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	l := newTestLocker(t, srv)
+
+	err := l.WithLease(ctx, "busy", func(ctx context.Context) error {
+		ran := false
+		err := l.WithLease(ctx, "busy", func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+
+		var heldErr *common.ErrLeaseHeld
+		g.Expect(errors.As(err, &heldErr)).To(BeTrue())
+		g.Expect(ran).To(BeFalse())
+
+		return nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// released once the run finishes
+	g.Expect(srv.Docs("locks")).ToNot(HaveKey("busy"))
+}
+
+func TestLockerLostLeaseCancelsRun(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	l := newTestLocker(t, srv, common.WithLeaseTTL(time.Second))
+
+	now := time.Now()
+	err := l.WithLease(ctx, "lost", func(ctx context.Context) error {
+		// another owner takes the lease over before it is renewed
+		g.Expect(srv.Put("locks", "lost", map[string]interface{}{
+			"Name": "lost", "Owner": "other/1", "Token": "other", "Acquired": now.UnixMicro(), "Expires": now.Add(time.Minute).UnixMicro(),
+		})).To(Succeed())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+			return nil
+		}
+	})
+	g.Expect(err).To(MatchError(context.Canceled))
+
+	// the lease which was taken over isn't released
+	g.Expect(srv.Docs("locks")["lost"]["Token"]).To(Equal("other"))
+}
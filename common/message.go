@@ -1,9 +1,47 @@
 package common
 
+import (
+	"fmt"
+	"time"
+)
+
 type Message struct {
 	MessageType string `json:"messageType"`
 	ID          string `json:"id"`
 	Delay       int    `json:"delay"`
+	// DeliverAt is either an RFC3339 time or a duration such as "90s" from when the message is sent,
+	// used instead of Delay
+	DeliverAt   string `json:"deliverAt,omitempty"`
 	PayloadType string `json:"payloadType"`
 	Payload     string `json:"payload"`
 }
+
+// DueAt returns when a message sent at sent should be delivered
+func (m *Message) DueAt(sent time.Time) (time.Time, error) {
+	if m.DeliverAt == "" {
+		if m.Delay < 0 {
+			return time.Time{}, fmt.Errorf("delay cannot be negative")
+		}
+
+		return sent.Add(time.Duration(m.Delay) * time.Second), nil
+	}
+
+	if m.Delay != 0 {
+		return time.Time{}, fmt.Errorf("only one of delay and deliverAt can be set")
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, m.DeliverAt); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(m.DeliverAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deliverAt %s, must be an RFC3339 time or a duration", m.DeliverAt)
+	}
+
+	if d < 0 {
+		return time.Time{}, fmt.Errorf("deliverAt duration cannot be negative")
+	}
+
+	return sent.Add(d), nil
+}
@@ -0,0 +1,278 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PayloadType maps a Message.PayloadType name to the Go type its payload decodes into
+type PayloadType struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+
+	typ reflect.Type
+}
+
+// ErrUnknownPayloadType is returned for payload types which haven't been registered
+type ErrUnknownPayloadType struct {
+	Name string
+}
+
+func (e *ErrUnknownPayloadType) Error() string {
+	return fmt.Sprintf("unknown payload type %q, must be one of [%s]", e.Name, strings.Join(PayloadTypeNames(), ", "))
+}
+
+var (
+	payloadTypesMu sync.RWMutex
+	payloadTypes   = map[string]*PayloadType{}
+)
+
+// RegisterPayloadType registers the type of prototype under name, generating its JSON Schema.
+// Payloads of string types are taken as is, all others are decoded from JSON.
+func RegisterPayloadType(name string, prototype interface{}) *PayloadType {
+	typ := reflect.TypeOf(prototype)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	pt := &PayloadType{Name: name, Schema: jsonSchema(typ), typ: typ}
+
+	payloadTypesMu.Lock()
+	defer payloadTypesMu.Unlock()
+
+	payloadTypes[name] = pt
+
+	return pt
+}
+
+// LookupPayloadType returns the registered payload type with the given name
+func LookupPayloadType(name string) (*PayloadType, error) {
+	payloadTypesMu.RLock()
+	defer payloadTypesMu.RUnlock()
+
+	pt, ok := payloadTypes[name]
+	if !ok {
+		return nil, &ErrUnknownPayloadType{Name: name}
+	}
+
+	return pt, nil
+}
+
+// PayloadTypes returns every registered payload type ordered by name
+func PayloadTypes() []*PayloadType {
+	payloadTypesMu.RLock()
+	defer payloadTypesMu.RUnlock()
+
+	pts := make([]*PayloadType, 0, len(payloadTypes))
+	for _, pt := range payloadTypes {
+		pts = append(pts, pt)
+	}
+
+	sort.Slice(pts, func(i, j int) bool {
+		return pts[i].Name < pts[j].Name
+	})
+
+	return pts
+}
+
+func PayloadTypeNames() []string {
+	names := []string{}
+	for _, pt := range PayloadTypes() {
+		names = append(names, pt.Name)
+	}
+
+	return names
+}
+
+// Decode validates the payload against the schema and decodes it into a new value of the registered type,
+// returned as a pointer for struct types
+func (pt *PayloadType) Decode(payload string) (interface{}, error) {
+	if pt.typ.Kind() == reflect.String {
+		return reflect.ValueOf(payload).Convert(pt.typ).Interface(), nil
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		return nil, fmt.Errorf("%s payload is not valid json: %w", pt.Name, err)
+	}
+
+	if err := validateSchema(pt.Schema, raw, "payload"); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", pt.Name, err)
+	}
+
+	v := reflect.New(pt.typ)
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(payload)))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", pt.Name, err)
+	}
+
+	if pt.typ.Kind() == reflect.Struct {
+		return v.Interface(), nil
+	}
+
+	return v.Elem().Interface(), nil
+}
+
+// DecodePayload decodes the message payload into the type registered for its PayloadType
+func (m *Message) DecodePayload() (interface{}, error) {
+	pt, err := LookupPayloadType(m.PayloadType)
+	if err != nil {
+		return nil, err
+	}
+
+	return pt.Decode(m.Payload)
+}
+
+// jsonFieldName returns the json name of a struct field, whether it can be omitted and whether it is encoded at all
+func jsonFieldName(f reflect.StructField) (string, bool, bool) {
+	if f.PkgPath != "" {
+		return "", false, false
+	}
+
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = f.Name
+	}
+
+	omitempty := false
+	for _, p := range parts[1:] {
+		if p == "omitempty" {
+			omitempty = true
+		}
+	}
+
+	return name, omitempty, true
+}
+
+// jsonSchema generates the JSON Schema for values of typ encoded by encoding/json
+func jsonSchema(typ reflect.Type) map[string]interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(typ.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(typ.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+
+		for i := 0; i < typ.NumField(); i++ {
+			name, omitempty, ok := jsonFieldName(typ.Field(i))
+			if !ok {
+				continue
+			}
+
+			properties[name] = jsonSchema(typ.Field(i).Type)
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// validateSchema checks a decoded json value against the subset of JSON Schema generated by jsonSchema
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	switch schema["type"] {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		for i, item := range items {
+			if err := validateSchema(itemSchema, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]string)
+
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+
+		for name, v := range obj {
+			if propSchema, ok := properties[name].(map[string]interface{}); ok {
+				if err := validateSchema(propSchema, v, path+"."+name); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s.%s is not allowed", path, name)
+				}
+			case map[string]interface{}:
+				if err := validateSchema(additional, v, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
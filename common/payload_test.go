@@ -0,0 +1,131 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+type testInner struct {
+	Count int `json:"count"`
+}
+
+type testPayload struct {
+	Name    string             `json:"name"`
+	Note    string             `json:"note,omitempty"`
+	Enabled bool               `json:"enabled"`
+	Count   int64              `json:"count"`
+	Ratio   float64            `json:"ratio"`
+	Tags    [][]string         `json:"tags"`
+	Weights map[string]float64 `json:"weights"`
+	Inner   *testInner         `json:"inner"`
+	Items   []testInner        `json:"items,omitempty"`
+	Default string
+	Skipped string `json:"-"`
+	hidden  string
+}
+
+func testPayloadType() *PayloadType {
+	typ := reflect.TypeOf(testPayload{})
+	return &PayloadType{Name: "Test", Schema: jsonSchema(typ), typ: typ}
+}
+
+func TestJSONSchema(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	schema := jsonSchema(reflect.TypeOf(&testPayload{}))
+
+	g.Expect(schema["type"]).To(Equal("object"))
+	g.Expect(schema["additionalProperties"]).To(Equal(false))
+	g.Expect(schema["required"]).To(ConsistOf("name", "enabled", "count", "ratio", "tags", "weights", "inner", "Default"))
+
+	properties := schema["properties"].(map[string]interface{})
+	g.Expect(properties).To(HaveLen(10))
+	g.Expect(properties).ToNot(HaveKey("Skipped"))
+	g.Expect(properties).ToNot(HaveKey("hidden"))
+
+	g.Expect(properties["count"]).To(Equal(map[string]interface{}{"type": "integer"}))
+	g.Expect(properties["ratio"]).To(Equal(map[string]interface{}{"type": "number"}))
+	g.Expect(properties["tags"]).To(Equal(map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	}))
+	g.Expect(properties["weights"]).To(Equal(map[string]interface{}{
+		"type": "object", "additionalProperties": map[string]interface{}{"type": "number"},
+	}))
+	g.Expect(properties["inner"]).To(HaveKeyWithValue("required", []string{"count"}))
+}
+
+func TestPayloadTypeDecode(t *testing.T) {
+	valid := `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[["x"]],"weights":{"w":1.5},"inner":{"count":1},"Default":""}`
+
+	tests := []struct {
+		name    string
+		payload string
+		err     string
+	}{
+		{name: "valid", payload: valid},
+		{name: "optional fields", payload: `{"name":"a","note":"n","enabled":false,"count":0,"ratio":1,"tags":[],"weights":{},"inner":{"count":0},"items":[{"count":2}],"Default":"d"}`},
+		{name: "not json", payload: `{"name":`, err: "Test payload is not valid json"},
+		{name: "not an object", payload: `[]`, err: "payload must be an object"},
+		{name: "unknown field", payload: `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[],"weights":{},"inner":{"count":1},"Default":"","colour":"red"}`, err: "payload.colour is not allowed"},
+		{name: "unknown nested field", payload: `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[],"weights":{},"inner":{"count":1,"extra":1},"Default":""}`, err: "payload.inner.extra is not allowed"},
+		{name: "ignored field", payload: `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[],"weights":{},"inner":{"count":1},"Default":"","Skipped":"s"}`, err: "payload.Skipped is not allowed"},
+		{name: "missing required field", payload: `{"enabled":true,"count":3,"ratio":0.5,"tags":[],"weights":{},"inner":{"count":1},"Default":""}`, err: "payload.name is required"},
+		{name: "missing nested required field", payload: `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[],"weights":{},"inner":{},"Default":""}`, err: "payload.inner.count is required"},
+		{name: "non integer number", payload: `{"name":"a","enabled":true,"count":3.5,"ratio":0.5,"tags":[],"weights":{},"inner":{"count":1},"Default":""}`, err: "payload.count must be an integer"},
+		{name: "integer as a string", payload: `{"name":"a","enabled":true,"count":"3","ratio":0.5,"tags":[],"weights":{},"inner":{"count":1},"Default":""}`, err: "payload.count must be an integer"},
+		{name: "wrong nested array item", payload: `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[["x",1]],"weights":{},"inner":{"count":1},"Default":""}`, err: "payload.tags[0][1] must be a string"},
+		{name: "wrong map value", payload: `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[],"weights":{"w":"heavy"},"inner":{"count":1},"Default":""}`, err: "payload.weights.w must be a number"},
+		{name: "wrong boolean", payload: `{"name":"a","enabled":"yes","count":3,"ratio":0.5,"tags":[],"weights":{},"inner":{"count":1},"Default":""}`, err: "payload.enabled must be a boolean"},
+		{name: "null object", payload: `{"name":"a","enabled":true,"count":3,"ratio":0.5,"tags":[],"weights":{},"inner":null,"Default":""}`, err: "payload.inner must be an object"},
+	}
+
+	pt := testPayloadType()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			v, err := pt.Decode(tt.payload)
+			if tt.err != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.err)))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(v).To(BeAssignableToTypeOf(&testPayload{}))
+		})
+	}
+
+	v, err := pt.Decode(valid)
+	NewGomegaWithT(t).Expect(err).ToNot(HaveOccurred())
+	NewGomegaWithT(t).Expect(v).To(Equal(&testPayload{
+		Name: "a", Enabled: true, Count: 3, Ratio: 0.5, Tags: [][]string{{"x"}},
+		Weights: map[string]float64{"w": 1.5}, Inner: &testInner{Count: 1},
+	}))
+}
+
+func TestRegisteredPayloadTypes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(PayloadTypeNames()).To(ContainElements(PayloadTypeNone, PayloadTypePing, PayloadTypeStore, PayloadTypeFail))
+
+	v, err := (&Message{PayloadType: PayloadTypeNone, Payload: "{not json"}).DecodePayload()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(v).To(Equal("{not json"))
+
+	v, err = (&Message{PayloadType: PayloadTypePing, Payload: `{"note":"hi"}`}).DecodePayload()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(v).To(Equal(&Ping{Note: "hi"}))
+
+	_, err = (&Message{PayloadType: PayloadTypePing, Payload: `{"colour":"red"}`}).DecodePayload()
+	g.Expect(err).To(MatchError(ContainSubstring("payload.colour is not allowed")))
+
+	_, err = (&Message{PayloadType: "Mystery", Payload: "{}"}).DecodePayload()
+
+	var unknown *ErrUnknownPayloadType
+	g.Expect(err).To(BeAssignableToTypeOf(unknown))
+	g.Expect(err).To(MatchError(ContainSubstring(`unknown payload type "Mystery"`)))
+}
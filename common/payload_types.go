@@ -0,0 +1,27 @@
+package common
+
+// payload types understood by the app
+const (
+	PayloadTypeNone  = "None"
+	PayloadTypePing  = "Ping"
+	PayloadTypeStore = "Store"
+	PayloadTypeFail  = "Fail"
+)
+
+// Ping asks the worker to acknowledge a message, with an optional note to record
+type Ping struct {
+	Note string `json:"note,omitempty"`
+}
+
+// Fail is never handled successfully, so tests can exercise retries and dead letters
+type Fail struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+func init() {
+	// None payloads are plain text
+	RegisterPayloadType(PayloadTypeNone, "")
+	RegisterPayloadType(PayloadTypePing, Ping{})
+	RegisterPayloadType(PayloadTypeStore, Store{})
+	RegisterPayloadType(PayloadTypeFail, Fail{})
+}
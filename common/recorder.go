@@ -0,0 +1,301 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/documents"
+)
+
+// ErrRecorderClosed is returned when recording to a FactRecorder which has been closed
+var ErrRecorderClosed = errors.New("fact recorder is closed")
+
+// FlushError reports the facts which could not be written during a flush, keyed by fact ID
+type FlushError struct {
+	Failed map[string]error
+	// IDs of the failed facts in the order they were recorded
+	IDs []string
+}
+
+func (e *FlushError) add(fact *Fact, err error) {
+	if e.Failed == nil {
+		e.Failed = map[string]error{}
+	}
+
+	e.Failed[fact.ID] = err
+	e.IDs = append(e.IDs, fact.ID)
+}
+
+func (e *FlushError) Error() string {
+	msgs := make([]string, 0, len(e.IDs))
+	for _, id := range e.IDs {
+		msgs = append(msgs, id+": "+e.Failed[id].Error())
+	}
+
+	return fmt.Sprintf("failed to write (%d) facts: %s", len(e.IDs), strings.Join(msgs, "; "))
+}
+
+// FactRecorder buffers facts and writes them to a collection in batches,
+// flushing when the buffer reaches the batch size, on an interval and on Close.
+type FactRecorder struct {
+	col         documents.CollectionRef
+	policy      RetryPolicy
+	batchSize   int
+	parallelism int
+	interval    time.Duration
+	sync        bool
+
+	mu      sync.Mutex
+	pending []*Fact
+	closed  bool
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type FactRecorderOption func(*FactRecorder)
+
+// WithBatchSize flushes the buffer once it holds size facts, zero leaves flushing to the interval and Close
+func WithBatchSize(size int) FactRecorderOption {
+	return func(r *FactRecorder) {
+		r.batchSize = size
+	}
+}
+
+// WithFlushInterval flushes the buffer in the background every interval. Facts which fail to
+// write in the background are kept buffered for the next flush, so Close reports them.
+func WithFlushInterval(interval time.Duration) FactRecorderOption {
+	return func(r *FactRecorder) {
+		r.interval = interval
+	}
+}
+
+// WithFlushParallelism sets how many sources a flush writes at once
+func WithFlushParallelism(n int) FactRecorderOption {
+	return func(r *FactRecorder) {
+		r.parallelism = n
+	}
+}
+
+// WithFactRetryPolicy sets the retry policy used for each fact write
+func WithFactRetryPolicy(policy RetryPolicy) FactRecorderOption {
+	return func(r *FactRecorder) {
+		r.policy = policy
+	}
+}
+
+// Synchronous writes every fact as it is recorded, which is what tests usually want
+func Synchronous() FactRecorderOption {
+	return func(r *FactRecorder) {
+		r.sync = true
+	}
+}
+
+func NewFactRecorder(col documents.CollectionRef, opts ...FactRecorderOption) *FactRecorder {
+	r := &FactRecorder{
+		col:         col,
+		policy:      DefaultRetryPolicy,
+		batchSize:   25,
+		parallelism: 8,
+		stop:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.parallelism < 1 {
+		r.parallelism = 1
+	}
+
+	if r.interval > 0 && !r.sync {
+		r.wg.Add(1)
+
+		go r.flushEvery(r.interval)
+	}
+
+	return r
+}
+
+func (r *FactRecorder) flushEvery(interval time.Duration) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if flushErr := r.flushKeepingFailed(context.Background()); flushErr != nil {
+				fmt.Println("fact recorder background flush:", flushErr)
+			}
+		}
+	}
+}
+
+// flushKeepingFailed flushes, putting facts which failed back in the buffer ahead of those recorded since,
+// so they are written by a later flush or reported by Close
+func (r *FactRecorder) flushKeepingFailed(ctx context.Context) *FlushError {
+	batch := r.take()
+
+	flushErr := r.write(ctx, batch)
+	if flushErr == nil {
+		return nil
+	}
+
+	retry := make([]*Fact, 0, len(flushErr.IDs))
+	for _, fact := range batch {
+		if _, ok := flushErr.Failed[fact.ID]; ok {
+			retry = append(retry, fact)
+		}
+	}
+
+	r.mu.Lock()
+	r.pending = append(retry, r.pending...)
+	r.mu.Unlock()
+
+	return flushErr
+}
+
+// Record buffers a fact, returning it so callers can match it against a later FlushError.
+// The error is from writing the fact in synchronous mode, or ErrRecorderClosed once the recorder is closed.
+// Facts which fail to write in a flush triggered by the batch size are kept buffered, like those from the
+// background flush, so a later Flush or Close reports them.
+func (r *FactRecorder) Record(ctx context.Context, source, action, data string) (*Fact, error) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+
+	if closed {
+		return nil, ErrRecorderClosed
+	}
+
+	fact := newFact(source, action, data)
+
+	if r.sync {
+		if err := chains.append(ctx, r.col, r.policy, fact); err != nil {
+			flushErr := &FlushError{}
+			flushErr.add(fact, err)
+
+			return fact, flushErr
+		}
+
+		return fact, nil
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRecorderClosed
+	}
+
+	r.pending = append(r.pending, fact)
+	full := r.batchSize > 0 && len(r.pending) >= r.batchSize
+	r.mu.Unlock()
+
+	if full {
+		if flushErr := r.flushKeepingFailed(ctx); flushErr != nil {
+			fmt.Println("fact recorder flush:", flushErr)
+		}
+	}
+
+	return fact, nil
+}
+
+func (r *FactRecorder) take() []*Fact {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch := r.pending
+	r.pending = nil
+
+	return batch
+}
+
+// write writes the batch, at most parallelism sources at a time, returning the facts which failed in recorded order.
+// The facts from each source are written in the order they were recorded, so they are chained in that order.
+func (r *FactRecorder) write(ctx context.Context, batch []*Fact) *FlushError {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	sources := []string{}
+	bySource := map[string][]int{}
+
+	for i, fact := range batch {
+		if _, ok := bySource[fact.Source]; !ok {
+			sources = append(sources, fact.Source)
+		}
+
+		bySource[fact.Source] = append(bySource[fact.Source], i)
+	}
+
+	errs := make([]error, len(batch))
+	sem := make(chan struct{}, r.parallelism)
+	wg := sync.WaitGroup{}
+
+	for _, source := range sources {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(facts []int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			for _, i := range facts {
+				errs[i] = chains.append(ctx, r.col, r.policy, batch[i])
+			}
+		}(bySource[source])
+	}
+
+	wg.Wait()
+
+	var flushErr *FlushError
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if flushErr == nil {
+			flushErr = &FlushError{}
+		}
+
+		flushErr.add(batch[i], err)
+	}
+
+	return flushErr
+}
+
+// Flush writes all buffered facts, returning a *FlushError listing any that failed
+func (r *FactRecorder) Flush(ctx context.Context) error {
+	if flushErr := r.write(ctx, r.take()); flushErr != nil {
+		return flushErr
+	}
+
+	return nil
+}
+
+// Close stops the background flush and writes anything still buffered. Facts recorded after Close
+// are refused with ErrRecorderClosed, and closing again only flushes.
+func (r *FactRecorder) Close(ctx context.Context) error {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+
+		close(r.stop)
+		r.wg.Wait()
+	})
+
+	return r.Flush(ctx)
+}
@@ -0,0 +1,143 @@
+package common_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+	"github.com/nitrictech/test-app/internal/docstest"
+)
+
+// failWrites fails every document write, counting the attempts
+func failWrites(srv *docstest.Server) *int32 {
+	attempts := int32(0)
+
+	srv.SetHook(func(op, collection, id string) error {
+		if op != "set" {
+			return nil
+		}
+
+		atomic.AddInt32(&attempts, 1)
+
+		return errors.New("unavailable")
+	})
+
+	return &attempts
+}
+
+// flushErrorIDs returns the IDs of the facts reported by a *common.FlushError
+func flushErrorIDs(err error) []string {
+	var flushErr *common.FlushError
+	if !errors.As(err, &flushErr) {
+		return nil
+	}
+
+	return flushErr.IDs
+}
+
+func TestRecorderKeepsFactsFromFailedSizeFlush(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	history := srv.Collection("history")
+	source := "recorder-size-" + uuid.New().String()
+
+	recorder := common.NewFactRecorder(history, common.WithBatchSize(2), common.WithFactRetryPolicy(common.NoRetry))
+
+	attempts := failWrites(srv)
+
+	first, err := recorder.Record(ctx, source, "recorded", "1")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// fills the batch, the flush fails but the facts stay buffered
+	second, err := recorder.Record(ctx, source, "recorded", "2")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(atomic.LoadInt32(attempts)).ToNot(BeZero())
+	g.Expect(srv.Docs("history")).To(BeEmpty())
+
+	srv.SetHook(nil)
+	g.Expect(recorder.Close(ctx)).To(Succeed())
+
+	g.Expect(srv.Docs("history")).To(HaveKey(first.ID))
+	g.Expect(srv.Docs("history")).To(HaveKey(second.ID))
+
+	facts, err := common.ReadFacts(ctx, history.Query())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(common.VerifyChain(facts).OK).To(BeTrue())
+}
+
+func TestRecorderCloseReportsFailedSizeFlush(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	source := "recorder-size-close-" + uuid.New().String()
+
+	recorder := common.NewFactRecorder(srv.Collection("history"), common.WithBatchSize(2), common.WithFactRetryPolicy(common.NoRetry))
+
+	failWrites(srv)
+
+	first, err := recorder.Record(ctx, source, "recorded", "1")
+	g.Expect(err).ToNot(HaveOccurred())
+	second, err := recorder.Record(ctx, source, "recorded", "2")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	err = recorder.Close(ctx)
+	g.Expect(flushErrorIDs(err)).To(Equal([]string{first.ID, second.ID}))
+}
+
+func TestRecorderCloseReportsFailedBackgroundFlush(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	source := "recorder-background-" + uuid.New().String()
+
+	recorder := common.NewFactRecorder(srv.Collection("history"),
+		common.WithBatchSize(0), common.WithFlushInterval(10*time.Millisecond), common.WithFactRetryPolicy(common.NoRetry))
+
+	attempts := failWrites(srv)
+
+	fact, err := recorder.Record(ctx, source, "recorded", "1")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// retried by each background flush
+	g.Eventually(func() int32 { return atomic.LoadInt32(attempts) }).Should(BeNumerically(">=", 2))
+
+	err = recorder.Close(ctx)
+	g.Expect(flushErrorIDs(err)).To(Equal([]string{fact.ID}))
+	g.Expect(srv.Docs("history")).To(BeEmpty())
+}
+
+func TestRecorderSynchronous(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	source := "recorder-sync-" + uuid.New().String()
+
+	recorder := common.NewFactRecorder(srv.Collection("history"), common.Synchronous(), common.WithFactRetryPolicy(common.NoRetry))
+
+	fact, err := recorder.Record(ctx, source, "recorded", "1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(srv.Docs("history")).To(HaveKey(fact.ID))
+
+	failWrites(srv)
+
+	failed, err := recorder.Record(ctx, source, "recorded", "2")
+	g.Expect(flushErrorIDs(err)).To(Equal([]string{failed.ID}))
+
+	srv.SetHook(nil)
+	g.Expect(recorder.Close(ctx)).To(Succeed())
+
+	_, err = recorder.Record(ctx, source, "recorded", "3")
+	g.Expect(err).To(MatchError(common.ErrRecorderClosed))
+	g.Expect(srv.Docs("history")).To(HaveLen(1))
+}
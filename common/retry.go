@@ -0,0 +1,113 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	apierrors "github.com/nitrictech/go-sdk/api/errors"
+	"github.com/nitrictech/go-sdk/api/errors/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy controls how many times, and how often, a failed operation is attempted
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, including the first
+	Attempts int
+	// Backoff is the wait before the second attempt, doubling for each attempt after that
+	Backoff time.Duration
+	// MaxBackoff caps the wait between attempts, zero leaves it uncapped
+	MaxBackoff time.Duration
+	// Jitter randomises each wait by up to this fraction of it, between 0 and 1
+	Jitter float64
+	// RetryableCodes limits retries to errors with these status codes, every error is retried when empty
+	RetryableCodes []codes.Code
+}
+
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 200 * time.Millisecond}
+
+// NoRetry attempts an operation exactly once
+var NoRetry = RetryPolicy{Attempts: 1}
+
+// ErrorCode returns the status code of a nitric api or grpc error, or Unknown for any other error
+func ErrorCode(err error) codes.Code {
+	var ae *apierrors.ApiError
+	if errors.As(err, &ae) {
+		return apierrors.Code(ae)
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return codes.Code(s.Code())
+	}
+
+	return codes.Unknown
+}
+
+// Retryable reports whether the policy retries the error
+func (p RetryPolicy) Retryable(err error) bool {
+	if len(p.RetryableCodes) == 0 {
+		return true
+	}
+
+	code := ErrorCode(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wait returns the jittered, capped backoff before the given attempt
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	backoff := p.Backoff
+	for i := 2; i < attempt; i++ {
+		backoff *= 2
+
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			break
+		}
+	}
+
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		backoff += time.Duration(float64(backoff) * p.Jitter * (2*rand.Float64() - 1))
+	}
+
+	return backoff
+}
+
+// Do calls fn until it succeeds, the attempts are exhausted, the error isn't retryable or the context is done,
+// returning the last error.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	return p.DoNotify(ctx, fn, nil)
+}
+
+// DoNotify is Do, calling notify with the number of each retry, the error which caused it and how long was waited
+// before it is attempted.
+func (p RetryPolicy) DoNotify(ctx context.Context, fn func() error, notify func(attempt int, err error, wait time.Duration)) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= p.Attempts || !p.Retryable(err) {
+			return err
+		}
+
+		wait := p.wait(attempt + 1)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		if notify != nil {
+			notify(attempt+1, err, wait)
+		}
+	}
+}
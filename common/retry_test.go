@@ -0,0 +1,120 @@
+package common_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/errors/codes"
+	. "github.com/onsi/gomega"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// retryWaits returns the wait before each retry of an operation which always fails with err
+func retryWaits(p common.RetryPolicy, err error) ([]time.Duration, int) {
+	waits := []time.Duration{}
+	calls := 0
+
+	_ = p.DoNotify(context.Background(), func() error {
+		calls++
+		return err
+	}, func(attempt int, err error, wait time.Duration) {
+		waits = append(waits, wait)
+	})
+
+	return waits, calls
+}
+
+func TestErrorCode(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(common.ErrorCode(status.Error(grpccodes.Unavailable, "down"))).To(Equal(codes.Unavailable))
+	g.Expect(common.ErrorCode(errors.New("plain"))).To(Equal(codes.Unknown))
+}
+
+func TestRetryableCodes(t *testing.T) {
+	p := common.RetryPolicy{Attempts: 3, RetryableCodes: []codes.Code{codes.Unavailable, codes.Aborted}}
+
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{name: "retryable code", err: status.Error(grpccodes.Unavailable, "down"), calls: 3},
+		{name: "another retryable code", err: status.Error(grpccodes.Aborted, "conflict"), calls: 3},
+		{name: "other code", err: status.Error(grpccodes.NotFound, "gone"), calls: 1},
+		{name: "no code", err: errors.New("plain"), calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			g.Expect(p.Retryable(tt.err)).To(Equal(tt.calls > 1))
+
+			_, calls := retryWaits(p, tt.err)
+			g.Expect(calls).To(Equal(tt.calls))
+		})
+	}
+
+	// without codes every error is retried
+	_, calls := retryWaits(common.RetryPolicy{Attempts: 2}, errors.New("plain"))
+	NewGomegaWithT(t).Expect(calls).To(Equal(2))
+}
+
+func TestRetryBackoffCapped(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := common.RetryPolicy{Attempts: 6, Backoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}
+
+	waits, calls := retryWaits(p, errors.New("failed"))
+	g.Expect(calls).To(Equal(6))
+	g.Expect(waits).To(Equal([]time.Duration{
+		time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond,
+	}))
+
+	// uncapped keeps doubling
+	p.MaxBackoff = 0
+	waits, _ = retryWaits(p, errors.New("failed"))
+	g.Expect(waits[4]).To(Equal(16 * time.Millisecond))
+}
+
+func TestRetryJitter(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := common.RetryPolicy{Attempts: 21, Backoff: time.Millisecond, MaxBackoff: time.Millisecond, Jitter: 0.5}
+
+	waits, _ := retryWaits(p, errors.New("failed"))
+	g.Expect(waits).To(HaveLen(20))
+
+	distinct := map[time.Duration]bool{}
+	for _, w := range waits {
+		g.Expect(w).To(BeNumerically(">=", 500*time.Microsecond))
+		g.Expect(w).To(BeNumerically("<=", 1500*time.Microsecond))
+
+		distinct[w] = true
+	}
+
+	g.Expect(len(distinct)).To(BeNumerically(">", 1))
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+
+	err := common.RetryPolicy{Attempts: 5, Backoff: time.Hour}.Do(ctx, func() error {
+		calls++
+		cancel()
+
+		return errors.New("failed")
+	})
+
+	g.Expect(err).To(MatchError("failed"))
+	g.Expect(calls).To(Equal(1))
+}
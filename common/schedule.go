@@ -0,0 +1,203 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/documents"
+)
+
+// Schedule runs a worker job at a rate, e.g. "5 minutes", or on a cron expression in a timezone
+type Schedule struct {
+	Name     string `json:"name"`
+	Rate     string `json:"rate,omitempty"`
+	Cron     string `json:"cron,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Job      string `json:"job"`
+}
+
+// DefaultSchedules are used when SCHEDULES isn't set
+var DefaultSchedules = []Schedule{
+	{Name: "five-min-schedule", Rate: "5 minutes", Job: JobConsumeQueue},
+	{Name: "staged-delivery", Rate: "1 minutes", Job: JobReleaseStaged},
+	{Name: "history-retention", Rate: "1 hours", Job: JobPruneHistory},
+	{Name: "processed-expiry", Cron: "30 * * * *", Job: JobExpireProcessed},
+}
+
+// LoadSchedules reads the schedules from the SCHEDULES environment variable, a json array of schedules,
+// falling back to the DefaultSchedules
+func LoadSchedules() ([]Schedule, error) {
+	v := os.Getenv("SCHEDULES")
+	if v == "" {
+		return DefaultSchedules, nil
+	}
+
+	schedules := []Schedule{}
+	if err := json.Unmarshal([]byte(v), &schedules); err != nil {
+		return nil, fmt.Errorf("invalid SCHEDULES json; %w", err)
+	}
+
+	if err := ValidateSchedules(schedules); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// workerSchedulesID is the document in the schedules collection holding the schedules the worker runs
+const workerSchedulesID = "worker"
+
+// PublishedSchedules are the schedules the worker runs, written to the schedules collection when it starts
+type PublishedSchedules struct {
+	// Schedules is the json array of schedules, in the same form as SCHEDULES
+	Schedules string
+	// Published is when the worker started in microseconds since the unix epoch
+	Published int64
+}
+
+// PublishSchedules records the schedules the worker runs, replacing those of any earlier deployment
+func PublishSchedules(ctx context.Context, col documents.CollectionRef, schedules []Schedule) error {
+	b, err := json.Marshal(schedules)
+	if err != nil {
+		return err
+	}
+
+	psMap := make(map[string]interface{})
+	if err := mapstructure.Decode(&PublishedSchedules{Schedules: string(b), Published: time.Now().UnixMicro()}, &psMap); err != nil {
+		return err
+	}
+
+	return col.Doc(workerSchedulesID).Set(ctx, psMap)
+}
+
+// ReadPublishedSchedules returns the schedules last published by the worker,
+// the error has a NotFound code until the worker has started
+func ReadPublishedSchedules(ctx context.Context, col documents.CollectionRef) ([]Schedule, error) {
+	doc, err := col.Doc(workerSchedulesID).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &PublishedSchedules{}
+	if err := mapstructure.Decode(doc.Content(), ps); err != nil {
+		return nil, err
+	}
+
+	schedules := []Schedule{}
+	if err := json.Unmarshal([]byte(ps.Schedules), &schedules); err != nil {
+		return nil, fmt.Errorf("invalid published schedules; %w", err)
+	}
+
+	return schedules, nil
+}
+
+// ValidateSchedules checks each schedule, and that their names are unique, reporting every problem found
+func ValidateSchedules(schedules []Schedule) error {
+	problems := []string{}
+	names := map[string]bool{}
+
+	for i, s := range schedules {
+		if err := s.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("schedule %d: %s", i, err.Error()))
+		}
+
+		if names[s.Name] {
+			problems = append(problems, fmt.Sprintf("schedule %d: duplicate name %s", i, s.Name))
+		}
+
+		names[s.Name] = true
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid schedules: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Validate checks the schedule has a name, a job and exactly one valid rate or cron expression
+func (s Schedule) Validate() error {
+	switch {
+	case s.Name == "":
+		return fmt.Errorf("name is required")
+	case s.Job == "":
+		return fmt.Errorf("%s job is required", s.Name)
+	case !KnownJob(s.Job):
+		return fmt.Errorf("%s has unknown job %s, must be one of [%s]", s.Name, s.Job, strings.Join(Jobs, ", "))
+	case s.Rate == "" && s.Cron == "":
+		return fmt.Errorf("%s requires a rate or cron expression", s.Name)
+	case s.Rate != "" && s.Cron != "":
+		return fmt.Errorf("%s can't have both a rate and a cron expression", s.Name)
+	case s.Name == ManualSchedule:
+		return fmt.Errorf("schedule name %s is reserved", ManualSchedule)
+	case s.Rate != "" && s.Timezone != "":
+		return fmt.Errorf("%s timezone only applies to cron expressions", s.Name)
+	case s.Cron != "":
+		if _, err := s.ParseCron(); err != nil {
+			return fmt.Errorf("%s %w", s.Name, err)
+		}
+
+		return nil
+	}
+
+	if err := ValidateRate(s.Rate); err != nil {
+		return fmt.Errorf("%s %w", s.Name, err)
+	}
+
+	return nil
+}
+
+// ParseCron parses the schedule's cron expression in its timezone
+func (s Schedule) ParseCron() (*Cron, error) {
+	return ParseCron(s.Cron, s.Timezone)
+}
+
+// Describe returns an english description of when the schedule runs
+func (s Schedule) Describe() string {
+	if s.Rate != "" {
+		parts := strings.Fields(s.Rate)
+		if len(parts) == 2 && parts[0] == "1" {
+			return "Every " + strings.TrimSuffix(parts[1], "s")
+		}
+
+		return "Every " + s.Rate
+	}
+
+	c, err := s.ParseCron()
+	if err != nil {
+		return err.Error()
+	}
+
+	return c.Describe() + " (" + c.Location().String() + ")"
+}
+
+// ValidateRate checks a rate is a positive number of minutes, hours or days, e.g. "5 minutes" or "day"
+func ValidateRate(rate string) error {
+	parts := strings.Fields(rate)
+
+	switch len(parts) {
+	case 1:
+		switch parts[0] {
+		case "minute", "hour", "day":
+			return nil
+		}
+	case 2:
+		n, err := strconv.Atoi(parts[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid rate %s, must start with a positive integer", rate)
+		}
+
+		switch parts[1] {
+		case "minutes", "hours", "days":
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid rate %s, must be a number of [minutes, hours, days]", rate)
+}
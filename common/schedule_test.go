@@ -0,0 +1,97 @@
+package common_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nitrictech/go-sdk/api/errors/codes"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+	"github.com/nitrictech/test-app/internal/docstest"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule common.Schedule
+		err      string
+	}{
+		{name: "rate", schedule: common.Schedule{Name: "a", Rate: "5 minutes", Job: common.JobConsumeQueue}},
+		{name: "single unit rate", schedule: common.Schedule{Name: "a", Rate: "hour", Job: common.JobConsumeQueue}},
+		{name: "cron", schedule: common.Schedule{Name: "a", Cron: "*/15 * * * *", Job: common.JobConsumeQueue}},
+		{name: "cron in a timezone", schedule: common.Schedule{Name: "a", Cron: "0 9 * * MON-FRI", Timezone: "Europe/London", Job: common.JobPruneHistory}},
+		{name: "no name", schedule: common.Schedule{Rate: "5 minutes", Job: common.JobConsumeQueue}, err: "name is required"},
+		{name: "no job", schedule: common.Schedule{Name: "a", Rate: "5 minutes"}, err: "a job is required"},
+		{name: "unknown job", schedule: common.Schedule{Name: "a", Rate: "5 minutes", Job: "dance"}, err: "unknown job dance"},
+		{name: "neither", schedule: common.Schedule{Name: "a", Job: common.JobConsumeQueue}, err: "requires a rate or cron expression"},
+		{name: "both", schedule: common.Schedule{Name: "a", Rate: "5 minutes", Cron: "* * * * *", Job: common.JobConsumeQueue}, err: "both a rate and a cron expression"},
+		{name: "reserved name", schedule: common.Schedule{Name: common.ManualSchedule, Rate: "5 minutes", Job: common.JobConsumeQueue}, err: "is reserved"},
+		{name: "rate in a timezone", schedule: common.Schedule{Name: "a", Rate: "5 minutes", Timezone: "UTC", Job: common.JobConsumeQueue}, err: "timezone only applies to cron"},
+		{name: "invalid rate", schedule: common.Schedule{Name: "a", Rate: "0 minutes", Job: common.JobConsumeQueue}, err: "must start with a positive integer"},
+		{name: "invalid rate unit", schedule: common.Schedule{Name: "a", Rate: "5 weeks", Job: common.JobConsumeQueue}, err: "must be a number of"},
+		{name: "invalid cron", schedule: common.Schedule{Name: "a", Cron: "* * *", Job: common.JobConsumeQueue}, err: "must have 5 fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			err := tt.schedule.Validate()
+			if tt.err == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.err)))
+			}
+		})
+	}
+}
+
+func TestLoadSchedules(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	t.Setenv("SCHEDULES", "")
+	schedules, err := common.LoadSchedules()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(schedules).To(Equal(common.DefaultSchedules))
+
+	t.Setenv("SCHEDULES", `[{"name":"a","rate":"1 minutes","job":"consume-queue"},{"name":"b","cron":"0 * * * *","timezone":"Asia/Tokyo","job":"prune-history"}]`)
+	schedules, err = common.LoadSchedules()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(schedules).To(HaveLen(2))
+	g.Expect(schedules[1].Timezone).To(Equal("Asia/Tokyo"))
+
+	t.Setenv("SCHEDULES", `[{"name":"a","rate":"1 minutes","job":"consume-queue"},{"name":"a","cron":"0 * * * *"}]`)
+	_, err = common.LoadSchedules()
+	g.Expect(err).To(MatchError(ContainSubstring("schedule 1: duplicate name a")))
+	g.Expect(err).To(MatchError(ContainSubstring("schedule 1: a job is required")))
+}
+
+func TestPublishedSchedules(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := docstest.Start(t)
+	col := srv.Collection("schedules")
+
+	_, err := common.ReadPublishedSchedules(ctx, col)
+	g.Expect(common.ErrorCode(err)).To(Equal(codes.NotFound))
+
+	g.Expect(common.PublishSchedules(ctx, col, common.DefaultSchedules)).To(Succeed())
+
+	published, err := common.ReadPublishedSchedules(ctx, col)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(published).To(Equal(common.DefaultSchedules))
+
+	// a later deployment replaces the schedules, in their configured order
+	later := []common.Schedule{
+		{Name: "nightly", Cron: "0 2 * * *", Timezone: "Europe/London", Job: common.JobPruneHistory},
+		{Name: "often", Rate: "1 minutes", Job: common.JobConsumeQueue},
+	}
+	g.Expect(common.PublishSchedules(ctx, col, later)).To(Succeed())
+
+	published, err = common.ReadPublishedSchedules(ctx, col)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(published).To(Equal(later))
+	g.Expect(srv.Docs("schedules")).To(HaveLen(1))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/errors/codes"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+const backupPrefix = "backups/"
+
+// conflict policies for restoring documents which already exist
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictFail      = "fail"
+)
+
+type exportRequest struct {
+	Name string `json:"name"`
+}
+
+type exportResult struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Count int    `json:"count"`
+}
+
+type importRequest struct {
+	Name   string `json:"name"`
+	Policy string `json:"policy"`
+}
+
+type importError struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+type importResult struct {
+	Name    string        `json:"name"`
+	Policy  string        `json:"policy"`
+	Total   int           `json:"total"`
+	Written int           `json:"written"`
+	Skipped int           `json:"skipped"`
+	Failed  int           `json:"failed"`
+	Errors  []importError `json:"errors"`
+}
+
+// storeExportHandler snapshots the store collection to a gzipped ndjson archive in the bucket
+func storeExportHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	req := &exportRequest{}
+	if len(hc.Request.Data()) > 0 {
+		if err := json.Unmarshal(hc.Request.Data(), req); err != nil {
+			return next(common.HttpResponse(hc, "error decoding json body", 400))
+		}
+	}
+
+	if req.Name == "" {
+		req.Name = backupPrefix + "store-" + time.Now().UTC().Format("20060102T150405Z") + ".ndjson.gz"
+	}
+
+	iter, err := storeCol.Query().Stream(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
+	}
+
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	enc := json.NewEncoder(zw)
+	res := &exportResult{Name: req.Name}
+
+	for {
+		doc, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return next(common.HttpResponse(hc, "error reading collection: "+err.Error(), 500))
+		}
+
+		store := &common.Store{}
+		if err := mapstructure.Decode(doc.Content(), store); err != nil {
+			return next(common.HttpResponse(hc, "error decoding store document: "+err.Error(), 500))
+		}
+
+		if err := enc.Encode(store); err != nil {
+			return next(common.HttpResponse(hc, "error encoding store document: "+err.Error(), 500))
+		}
+
+		res.Count++
+	}
+
+	if err := zw.Close(); err != nil {
+		return next(common.HttpResponse(hc, "error compressing archive: "+err.Error(), 500))
+	}
+
+	if err := bucky.File(res.Name).Write(hc.Request.Context(), buf.Bytes()); err != nil {
+		return next(common.HttpResponse(hc, "error writing archive: "+err.Error(), 500))
+	}
+
+	res.URL, err = bucky.File(res.Name).DownloadUrl(hc.Request.Context(), int(time.Hour.Seconds()))
+	if err != nil {
+		return next(common.HttpResponse(hc, "error signing archive url: "+err.Error(), 500))
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	fmt.Printf("exported %d store documents to %s\n", res.Count, res.Name)
+	hc.Response.Status = 200
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
+
+// storeImportHandler replays an archive written by storeExportHandler into the store collection
+func storeImportHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	req := &importRequest{}
+	if err := json.Unmarshal(hc.Request.Data(), req); err != nil {
+		return next(common.HttpResponse(hc, "error decoding json body", 400))
+	}
+
+	if req.Name == "" {
+		return next(common.HttpResponse(hc, "archive name is required", 400))
+	}
+
+	req.Policy = strings.ToLower(req.Policy)
+	switch req.Policy {
+	case "":
+		req.Policy = conflictSkip
+	case conflictSkip, conflictOverwrite, conflictFail:
+	default:
+		return next(common.HttpResponse(hc, fmt.Sprintf("unknown conflict policy %s, must be one of [skip, overwrite, fail]", req.Policy), 400))
+	}
+
+	archive, err := bucky.File(req.Name).Read(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error reading archive "+req.Name+": "+err.Error(), 404))
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return next(common.HttpResponse(hc, "error decompressing archive: "+err.Error(), 400))
+	}
+
+	res := &importResult{Name: req.Name, Policy: req.Policy, Errors: []importError{}}
+	status := http.StatusOK
+
+	stores := []*common.Store{}
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		res.Total++
+
+		store := &common.Store{}
+		if err := json.Unmarshal(scanner.Bytes(), store); err != nil {
+			res.Failed++
+			res.Errors = append(res.Errors, importError{Error: fmt.Sprintf("line %d: %s", res.Total, err.Error())})
+
+			continue
+		}
+
+		stores = append(stores, store)
+	}
+
+	if err := scanner.Err(); err != nil {
+		res.Errors = append(res.Errors, importError{Error: "error reading archive: " + err.Error()})
+		status = http.StatusBadRequest
+	}
+
+	// check every document for a conflict before writing any, so a failed import doesn't leave a partial restore
+	writes := stores
+	if req.Policy != conflictOverwrite && status == http.StatusOK {
+		writes = []*common.Store{}
+		unchecked := 0
+
+		for _, store := range stores {
+			exists, err := storeExists(hc.Request.Context(), store.ID)
+
+			switch {
+			case err != nil:
+				unchecked++
+				res.Failed++
+				res.Errors = append(res.Errors, importError{ID: store.ID, Error: "error checking for document: " + err.Error()})
+			case exists && req.Policy == conflictSkip:
+				res.Skipped++
+			case exists:
+				res.Failed++
+				res.Errors = append(res.Errors, importError{ID: store.ID, Error: "document already exists"})
+				status = http.StatusConflict
+			default:
+				writes = append(writes, store)
+			}
+		}
+
+		if req.Policy == conflictFail && unchecked > 0 && status == http.StatusOK {
+			// the conflicts couldn't all be checked
+			status = http.StatusBadGateway
+		}
+	}
+
+	if status != http.StatusOK {
+		writes = nil
+	}
+
+	for _, store := range writes {
+		storeMap := make(map[string]interface{})
+		if err := mapstructure.Decode(store, &storeMap); err != nil {
+			res.Failed++
+			res.Errors = append(res.Errors, importError{ID: store.ID, Error: err.Error()})
+
+			continue
+		}
+
+		if err := storeCol.Doc(store.ID).Set(hc.Request.Context(), storeMap); err != nil {
+			res.Failed++
+			res.Errors = append(res.Errors, importError{ID: store.ID, Error: err.Error()})
+
+			continue
+		}
+
+		res.Written++
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	fmt.Printf("imported %s: %d written, %d skipped, %d failed\n", res.Name, res.Written, res.Skipped, res.Failed)
+	hc.Response.Status = status
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
+
+// storeExists reports whether the store document exists, only a NotFound error means it doesn't
+func storeExists(ctx context.Context, id string) (bool, error) {
+	_, err := storeCol.Doc(id).Get(ctx)
+	if common.ErrorCode(err) == codes.NotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
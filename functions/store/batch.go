@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/queues"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// maximum number of topic events published at once by a batch send
+const batchParallelism = 8
+
+// sendResult reports the outcome of sending one message of a batch
+type sendResult struct {
+	ID          string `json:"id"`
+	MessageType string `json:"messageType"`
+	Sent        bool   `json:"sent"`
+	Error       string `json:"error,omitempty"`
+
+	// set when the message was valid but couldn't be sent
+	upstream bool
+}
+
+func (r *sendResult) fail(err error) {
+	r.Sent = false
+	r.Error = err.Error()
+}
+
+// failUpstream marks the message as failed by the queue, topic or documents service it was sent to
+func (r *sendResult) failUpstream(err error) {
+	r.fail(err)
+	r.upstream = true
+}
+
+// sendBatchPostHandler sends an array of messages, queue messages due now in a single queue.Send,
+// delayed queue messages staged, and topic messages published concurrently, reporting the result of each in request order
+func sendBatchPostHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	msgs := []common.Message{}
+	if err := json.Unmarshal(hc.Request.Data(), &msgs); err != nil {
+		return next(common.HttpResponse(hc, "error decoding json body", 400))
+	}
+
+	if len(msgs) == 0 {
+		return next(common.HttpResponse(hc, "batch must contain at least one message", 400))
+	}
+
+	ctx := hc.Request.Context()
+	now := time.Now()
+	results := make([]sendResult, len(msgs))
+	payloads := make([]map[string]interface{}, len(msgs))
+	delays := make([]time.Duration, len(msgs))
+
+	var (
+		tasks      []*queues.Task
+		taskIndex  = map[string]int{}
+		topicIndex []int
+	)
+
+	for i := range msgs {
+		m := &msgs[i]
+		mMap, err := messagePayload(m)
+		results[i] = sendResult{ID: m.ID, MessageType: m.MessageType, Sent: true}
+		payloads[i] = mMap
+
+		if err != nil {
+			results[i].fail(fmt.Errorf("error decoding message document: %w", err))
+			continue
+		}
+
+		if _, err := m.DecodePayload(); err != nil {
+			results[i].fail(err)
+			continue
+		}
+
+		delays[i], err = deliveryDelay(m, now)
+		if err != nil {
+			results[i].fail(err)
+			continue
+		}
+
+		switch strings.ToLower(m.MessageType) {
+		case "topic":
+			topicIndex = append(topicIndex, i)
+		case "queue":
+			if delays[i] > 0 {
+				if err := stageTask(ctx, m, mMap, now.Add(delays[i])); err != nil {
+					results[i].failUpstream(err)
+				}
+
+				continue
+			}
+
+			if _, ok := taskIndex[m.ID]; ok {
+				results[i].fail(fmt.Errorf("duplicate message id %s in batch", m.ID))
+				continue
+			}
+
+			tasks = append(tasks, queueTask(m, mMap))
+			taskIndex[m.ID] = i
+		default:
+			results[i].fail(fmt.Errorf("unknown message type %s", m.MessageType))
+		}
+	}
+
+	if len(tasks) > 0 {
+		failed, err := queue.Send(ctx, tasks)
+		if err != nil {
+			for _, i := range taskIndex {
+				results[i].failUpstream(err)
+			}
+		}
+
+		for _, ft := range failed {
+			if i, ok := taskIndex[ft.Task.ID]; ok {
+				results[i].failUpstream(fmt.Errorf("queue rejected task: %s", ft.Reason))
+			}
+		}
+	}
+
+	sem := make(chan struct{}, batchParallelism)
+	wg := sync.WaitGroup{}
+
+	for _, i := range topicIndex {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := publishEvent(ctx, &msgs[i], payloads[i], delays[i]); err != nil {
+				results[i].failUpstream(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	recorder := common.NewFactRecorder(history, common.WithBatchSize(0))
+
+	for i := range msgs {
+		var sendErr error
+		if !results[i].Sent {
+			sendErr = errors.New(results[i].Error)
+		}
+
+		action, data, err := sendOutcome(&msgs[i], sendErr)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		_, _ = recorder.Record(ctx, sendSource, action, data)
+	}
+
+	if err := recorder.Close(ctx); err != nil {
+		fmt.Println(err)
+	}
+
+	b, err := json.Marshal(results)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	sent, upstream := 0, 0
+	for _, r := range results {
+		switch {
+		case r.Sent:
+			sent++
+		case r.upstream:
+			upstream++
+		}
+	}
+
+	// 207 when only some of the batch was sent, when none of it was 502 if any message failed upstream, otherwise 400
+	status := http.StatusOK
+	switch {
+	case sent == 0 && upstream > 0:
+		status = http.StatusBadGateway
+	case sent == 0:
+		status = http.StatusBadRequest
+	case sent < len(msgs):
+		status = http.StatusMultiStatus
+	}
+
+	fmt.Printf("sent (%d) of a batch of (%d) messages\n", sent, len(msgs))
+	hc.Response.Status = status
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/events"
+	"github.com/nitrictech/go-sdk/api/queues"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func dlqGetHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	results, err := dlq.Query().Fetch(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
+	}
+
+	dls := make([]common.DeadLetter, 0, len(results.Documents))
+	for _, doc := range results.Documents {
+		dl := common.DeadLetter{}
+		if err := mapstructure.Decode(doc.Content(), &dl); err != nil {
+			return next(common.HttpResponse(hc, "error decoding dead letter document: "+err.Error(), 500))
+		}
+
+		dls = append(dls, dl)
+	}
+
+	b, err := json.Marshal(dls)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
+
+// replay sends a dead lettered task back to the queue, or publishes a dead lettered event to its topic again
+func replay(ctx context.Context, dl *common.DeadLetter) error {
+	if dl.Topic != "" {
+		_, err := topic.Publish(ctx, &events.Event{
+			ID:          dl.ReplayID(),
+			PayloadType: dl.PayloadType,
+			Payload:     dl.Payload,
+		})
+
+		return err
+	}
+
+	failed, err := queue.Send(ctx, []*queues.Task{
+		{
+			ID:          dl.ReplayID(),
+			PayloadType: dl.PayloadType,
+			Payload:     dl.Payload,
+		},
+	})
+	if err == nil && len(failed) > 0 {
+		err = errors.New(failed[0].Reason)
+	}
+
+	return err
+}
+
+// dlqReplayHandler sends a dead letter back to its queue or topic, removing it from the dead letters
+func dlqReplayHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	params := hc.Request.PathParams()
+	if params == nil {
+		return next(common.HttpResponse(hc, "error retrieving path params", 400))
+	}
+
+	id := params["id"]
+
+	doc, err := dlq.Doc(id).Get(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error retrieving dead letter "+id, 404))
+	}
+
+	dl := &common.DeadLetter{}
+	if err := mapstructure.Decode(doc.Content(), dl); err != nil {
+		return next(common.HttpResponse(hc, "error decoding dead letter document: "+err.Error(), 500))
+	}
+
+	if err := replay(hc.Request.Context(), dl); err != nil {
+		return next(common.HttpResponse(hc, "error replaying "+id+": "+err.Error(), 502))
+	}
+
+	if err := dlq.Doc(id).Delete(hc.Request.Context()); err != nil {
+		return next(common.HttpResponse(hc, "replayed "+id+" but could not remove the dead letter: "+err.Error(), 500))
+	}
+
+	b, err := json.Marshal(dl)
+	if err == nil {
+		err = common.RecordFact(hc.Request.Context(), history, "work-dlq", "replayed", string(b))
+	}
+
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	return next(common.HttpResponse(hc, "Replayed dead letter with ID: "+id, 200))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/faas"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// maxExportBytes caps the size of an export. Nitric http responses are a single []byte body, so the export
+// is built in memory rather than streamed to the client.
+const maxExportBytes = 32 << 20
+
+var errExportTooLarge = fmt.Errorf("export exceeds %d bytes, narrow it with since, until, source or action", maxExportBytes)
+
+// cappedBuffer is a bytes.Buffer which fails writes past maxExportBytes
+type cappedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxExportBytes {
+		return 0, errExportTooLarge
+	}
+
+	return b.Buffer.Write(p)
+}
+
+// factRow is the parquet schema for an exported fact
+type factRow struct {
+	ID        string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Occured   string `parquet:"name=occured, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Sequence  int64  `parquet:"name=sequence, type=INT64"`
+	Source    string `parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Action    string `parquet:"name=action, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Data      string `parquet:"name=data, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Instance  string `parquet:"name=instance, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// factEncoder writes facts one at a time in a given export format
+type factEncoder interface {
+	Encode(f *common.Fact) error
+	Close() error
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(f *common.Fact) error {
+	return e.enc.Encode(f)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Encode(f *common.Fact) error {
+	return e.w.Write([]string{
+		f.ID,
+		f.Occured,
+		strconv.FormatInt(f.Timestamp, 10),
+		strconv.FormatInt(f.Sequence, 10),
+		f.Source,
+		f.Action,
+		f.Data,
+		f.Instance,
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type parquetEncoder struct {
+	pw *writer.ParquetWriter
+}
+
+func (e *parquetEncoder) Encode(f *common.Fact) error {
+	return e.pw.Write(factRow{
+		ID:        f.ID,
+		Occured:   f.Occured,
+		Timestamp: f.Timestamp,
+		Sequence:  f.Sequence,
+		Source:    f.Source,
+		Action:    f.Action,
+		Data:      f.Data,
+		Instance:  f.Instance,
+	})
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.pw.WriteStop()
+}
+
+func newFactEncoder(format string, w io.Writer) (factEncoder, string, error) {
+	switch format {
+	case "", "ndjson":
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, "application/x-ndjson", nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "occured", "timestamp", "sequence", "source", "action", "data", "instance"}); err != nil {
+			return nil, "", err
+		}
+
+		return &csvEncoder{w: cw}, "text/csv", nil
+	case "parquet":
+		pw, err := writer.NewParquetWriterFromWriter(w, new(factRow), 1)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return &parquetEncoder{pw: pw}, "application/vnd.apache.parquet", nil
+	default:
+		return nil, "", fmt.Errorf("unknown export format %s, must be one of [ndjson, csv, parquet]", format)
+	}
+}
+
+// exportErrorResponse responds 413 when the export is too large, which the csv and parquet writers may only
+// report once they flush, otherwise 500
+func exportErrorResponse(hc *faas.HttpContext, err error) *faas.HttpContext {
+	if errors.Is(err, errExportTooLarge) || strings.Contains(err.Error(), errExportTooLarge.Error()) {
+		return common.HttpResponse(hc, errExportTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	}
+
+	return common.HttpResponse(hc, "error encoding facts: "+err.Error(), 500)
+}
+
+func historyExportHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	format := strings.ToLower(queryParam(hc, "format"))
+
+	ff, err := parseFactFilter(hc)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
+	}
+
+	buf := &cappedBuffer{}
+
+	enc, contentType, err := newFactEncoder(format, buf)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
+	}
+
+	iter, err := ff.query().Stream(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
+	}
+
+	for {
+		doc, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return next(common.HttpResponse(hc, "error reading collection: "+err.Error(), 500))
+		}
+
+		f := &common.Fact{}
+		if err := mapstructure.Decode(doc.Content(), f); err != nil {
+			return next(common.HttpResponse(hc, "error decoding fact document: "+err.Error(), 500))
+		}
+
+		if !ff.matches(f) {
+			continue
+		}
+
+		if err := enc.Encode(f); err != nil {
+			return next(exportErrorResponse(hc, err))
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return next(exportErrorResponse(hc, err))
+	}
+
+	if format == "" {
+		format = "ndjson"
+	}
+
+	hc.Response.Status = http.StatusOK
+	hc.Response.Body = buf.Bytes()
+	hc.Response.Headers["Content-Type"] = []string{contentType}
+	hc.Response.Headers["Content-Disposition"] = []string{"attachment; filename=history." + format}
+
+	return next(hc)
+}
@@ -1,25 +1,121 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
+	"github.com/nitrictech/go-sdk/api/documents"
 	"github.com/nitrictech/go-sdk/faas"
 	"github.com/nitrictech/test-app/common"
 )
 
-func historyGetHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+// queryParam returns the first value of the named query parameter
+func queryParam(hc *faas.HttpContext, name string) string {
+	values := hc.Request.Query()[name]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// factFilter selects facts by source, action and a [since, until) time range
+type factFilter struct {
+	source string
+	action string
+	since  time.Time
+	until  time.Time
+}
+
+func parseFactFilter(hc *faas.HttpContext) (*factFilter, error) {
+	ff := &factFilter{
+		source: queryParam(hc, "source"),
+		action: queryParam(hc, "action"),
+	}
+
+	var err error
+
+	if s := queryParam(hc, "since"); s != "" {
+		ff.since, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since %s; %w", s, err)
+		}
+	}
+
+	if s := queryParam(hc, "until"); s != "" {
+		ff.until, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until %s; %w", s, err)
+		}
+	}
+
+	return ff, nil
+}
+
+// query selects facts by source and action. The time range is applied by matches, as facts recorded before
+// Timestamp existed can only be placed in time by their Occured string, which doesn't sort.
+func (ff *factFilter) query() documents.Query {
 	query := history.Query()
-	results, err := query.Fetch(hc.Request.Context())
+
+	if ff.source != "" {
+		query = query.Where(documents.Condition("Source").Eq(documents.StringValue(ff.source)))
+	}
+
+	if ff.action != "" {
+		query = query.Where(documents.Condition("Action").Eq(documents.StringValue(ff.action)))
+	}
+
+	return query
+}
+
+// matches reports whether the fact falls in the time range
+func (ff *factFilter) matches(f *common.Fact) bool {
+	t := f.Time()
+
+	if !ff.since.IsZero() && t.Before(ff.since) {
+		return false
+	}
+
+	if !ff.until.IsZero() && !t.Before(ff.until) {
+		return false
+	}
+
+	return true
+}
+
+// read returns every fact matching the filter
+func (ff *factFilter) read(ctx context.Context) ([]common.Fact, error) {
+	facts, err := common.ReadFacts(ctx, ff.query())
 	if err != nil {
-		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
+		return nil, err
+	}
+
+	matched := facts[:0]
+	for i := range facts {
+		if ff.matches(&facts[i]) {
+			matched = append(matched, facts[i])
+		}
+	}
+
+	return matched, nil
+}
+
+func historyGetHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	ff, err := parseFactFilter(hc)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
 	}
 
-	docs := make([]map[string]interface{}, 0)
-	for _, doc := range results.Documents {
-		docs = append(docs, doc.Content())
+	facts, err := ff.read(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
 	}
 
-	b, err := json.Marshal(docs)
+	common.SortFacts(facts)
+
+	b, err := json.Marshal(facts)
 	if err != nil {
 		return next(common.HttpResponse(hc, err.Error(), 400))
 	}
@@ -30,6 +126,26 @@ func historyGetHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpC
 	return next(hc)
 }
 
+// historyVerifyHandler walks the hash chain of every source, or just ?source=, reporting gaps and modifications
+func historyVerifyHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	ff := &factFilter{source: queryParam(hc, "source")}
+
+	facts, err := ff.read(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
+	}
+
+	b, err := json.Marshal(common.VerifyChain(facts))
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
+
 func factDeleteHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
 	params := hc.Request.PathParams()
 	if params == nil {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/events"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// authorized checks the request has the JOBS_TOKEN bearer token, returning the status to respond with if it hasn't.
+// Manual triggers are disabled when JOBS_TOKEN isn't set.
+func authorized(hc *faas.HttpContext) (int, string) {
+	token := os.Getenv("JOBS_TOKEN")
+	if token == "" {
+		return http.StatusForbidden, "manual job triggers are disabled, JOBS_TOKEN is not set"
+	}
+
+	auth := ""
+	for k, v := range hc.Request.Headers() {
+		if strings.EqualFold(k, "Authorization") && len(v) > 0 {
+			auth = v[0]
+		}
+	}
+
+	bearer := strings.TrimPrefix(auth, "Bearer ")
+	if bearer == auth || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		return http.StatusUnauthorized, "a valid bearer token is required"
+	}
+
+	return http.StatusOK, ""
+}
+
+// jobRunPostHandler publishes a trigger for the worker to run a job now. The name is a schedule, to run its job
+// and record the run against it, or a job. The worker resolves the name against the schedules it runs, recording
+// a failed run when it is neither.
+func jobRunPostHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	if status, msg := authorized(hc); status != http.StatusOK {
+		hc.Response.Headers["WWW-Authenticate"] = []string{"Bearer"}
+		return next(common.HttpResponse(hc, msg, status))
+	}
+
+	params := hc.Request.PathParams()
+	if params == nil || params["name"] == "" {
+		return next(common.HttpResponse(hc, "error retrieving path params", 400))
+	}
+
+	trigger := &common.JobTrigger{ID: uuid.New().String(), Name: params["name"]}
+
+	payload := make(map[string]interface{})
+	if err := mapstructure.Decode(trigger, &payload); err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	_, err := triggers.Publish(hc.Request.Context(), &events.Event{
+		ID:          trigger.ID,
+		PayloadType: "JobTrigger",
+		Payload:     payload,
+	})
+	if err != nil {
+		return next(common.HttpResponse(hc, "error publishing trigger: "+err.Error(), 502))
+	}
+
+	b, err := json.Marshal(trigger)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	fmt.Printf("triggered %s as run %s\n", trigger.Name, trigger.ID)
+	hc.Response.Status = http.StatusAccepted
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
@@ -12,14 +12,21 @@ import (
 	"github.com/nitrictech/go-sdk/api/secrets"
 	"github.com/nitrictech/go-sdk/api/storage"
 	"github.com/nitrictech/go-sdk/resources"
+
+	"github.com/nitrictech/test-app/common"
 )
 
 var (
 	mainApi  resources.Api
 	storeCol documents.CollectionRef
 	history  documents.CollectionRef
+	staged   documents.CollectionRef
+	dlq      documents.CollectionRef
+	jobRuns  documents.CollectionRef
+	schedCol documents.CollectionRef
 	queue    queues.Queue
 	topic    resources.Topic
+	triggers resources.Topic
 	safe     secrets.SecretRef
 	bucky    storage.Bucket
 )
@@ -39,6 +46,11 @@ func run() error {
 		}()
 	}
 
+	// fail fast on a misconfigured delay rather than rejecting every delayed message
+	if _, err := common.MaxDelay("topic"); err != nil {
+		return err
+	}
+
 	var err error
 
 	safe, err = resources.NewSecret("safe", resources.SecretEverything...)
@@ -56,6 +68,11 @@ func run() error {
 		return err
 	}
 
+	triggers, err = resources.NewTopic("job-trigger", resources.TopicPublishing)
+	if err != nil {
+		return err
+	}
+
 	bucky, err = resources.NewBucket("bucky", resources.BucketEverything...)
 	if err != nil {
 		return err
@@ -71,15 +88,49 @@ func run() error {
 		return err
 	}
 
+	staged, err = resources.NewCollection("staged", resources.CollectionWriting)
+	if err != nil {
+		return err
+	}
+
+	dlq, err = resources.NewCollection("work-dlq", resources.CollectionReading, resources.CollectionDeleting)
+	if err != nil {
+		return err
+	}
+
+	jobRuns, err = resources.NewCollection("job-runs", resources.CollectionReading)
+	if err != nil {
+		return err
+	}
+
+	// the schedules published by the worker
+	schedCol, err = resources.NewCollection("schedules", resources.CollectionReading)
+	if err != nil {
+		return err
+	}
+
 	mainApi, err = resources.NewApi("nitric-testr")
 	if err != nil {
 		return err
 	}
 
 	mainApi.Get("/history", historyGetHandler)
+	mainApi.Get("/history/export", historyExportHandler)
+	mainApi.Get("/history/verify", historyVerifyHandler)
+	mainApi.Get("/history/stats", historyStatsHandler)
+	mainApi.Get("/history/reconcile", reconcileHandler)
 	mainApi.Delete("/history/:id", factDeleteHandler)
 
 	mainApi.Post("/send", sendPostHandler)
+	mainApi.Post("/send/batch", sendBatchPostHandler)
+	mainApi.Get("/payload-types", payloadTypesGetHandler)
+
+	mainApi.Get("/dlq", dlqGetHandler)
+	mainApi.Post("/dlq/:id/replay", dlqReplayHandler)
+
+	mainApi.Get("/schedules", schedulesGetHandler)
+	mainApi.Get("/schedules/runs", scheduleRunsGetHandler)
+	mainApi.Post("/jobs/:name/run", jobRunPostHandler)
 
 	mainApi.Post("/safe", safePostHandler)
 	mainApi.Get("/safe", safeGetHandler)
@@ -93,6 +144,8 @@ func run() error {
 	mainApi.Get("/store/:id", getHandler)
 	mainApi.Put("/store/:id", putHandler)
 	mainApi.Delete("/store/:id", deleteHandler)
+	mainApi.Post("/store/export", storeExportHandler)
+	mainApi.Post("/store/import", storeImportHandler)
 
 	err = resources.Run()
 	if err != nil && !strings.Contains(err.Error(), "EOF") {
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// default allowance on top of the requested delay before a delivery is considered late,
+// queue tasks wait for the worker's five minute schedule so get more
+var defaultTolerance = map[string]time.Duration{
+	"topic": time.Minute,
+	"queue": 6 * time.Minute,
+}
+
+// deliveryAction is the fact the worker records when it receives each type of message
+var deliveryAction = map[string]string{
+	"topic": actionReceivedEvent,
+	"queue": actionTaskComplete,
+}
+
+type reconcileEntry struct {
+	ID          string  `json:"id"`
+	MessageType string  `json:"messageType"`
+	Sent        string  `json:"sent"`
+	Due         string  `json:"due"`
+	Deliveries  int     `json:"deliveries"`
+	Delivered   string  `json:"delivered,omitempty"`
+	LatencyMs   float64 `json:"latencyMs,omitempty"`
+
+	sentAt time.Time
+}
+
+type reconcileReport struct {
+	Checked   int `json:"checked"`
+	Delivered int `json:"delivered"`
+	Pending   int `json:"pending"`
+	// Unmatched counts messages delivered in the window which have no sent fact
+	Unmatched   int              `json:"unmatched"`
+	Undelivered []reconcileEntry `json:"undelivered"`
+	Duplicated  []reconcileEntry `json:"duplicated"`
+	Late        []reconcileEntry `json:"late"`
+}
+
+func parseDurationParam(hc *faas.HttpContext, name string) (time.Duration, bool, error) {
+	v := queryParam(hc, name)
+	if v == "" {
+		return 0, false, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s %s; %w", name, v, err)
+	}
+
+	return d, true, nil
+}
+
+// reconcileHandler matches sent messages to their deliveries, reporting messages which were never delivered,
+// delivered more than once, or delivered later than they were due plus a tolerance.
+// Messages are only reported as undelivered once ?grace= (default 10m) has passed since they were due.
+func reconcileHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	ff, err := parseFactFilter(hc)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
+	}
+
+	grace, ok, err := parseDurationParam(hc, "grace")
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
+	}
+
+	if !ok {
+		grace = 10 * time.Minute
+	}
+
+	tolerance, overrideTolerance, err := parseDurationParam(hc, "tolerance")
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
+	}
+
+	// the filter only applies to the sent facts, deliveries may fall outside the window
+	facts, err := common.ReadFacts(hc.Request.Context(), history.Query())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
+	}
+
+	now := time.Now()
+	report := &reconcileReport{
+		Undelivered: []reconcileEntry{},
+		Duplicated:  []reconcileEntry{},
+		Late:        []reconcileEntry{},
+	}
+
+	for id, d := range deliveries(facts) {
+		if len(d.sent) == 0 {
+			if unmatched(d, ff) {
+				report.Unmatched++
+			}
+
+			continue
+		}
+
+		sentFact := d.sent[0]
+		sent := sentFact.Time()
+
+		if (!ff.since.IsZero() && sent.Before(ff.since)) || (!ff.until.IsZero() && !sent.Before(ff.until)) {
+			continue
+		}
+
+		m := &common.Message{}
+		if err := json.Unmarshal([]byte(sentFact.Data), m); err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		messageType := strings.ToLower(m.MessageType)
+		received := d.received[deliveryAction[messageType]]
+		due, err := m.DueAt(sent)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		report.Checked++
+
+		entry := reconcileEntry{
+			ID:          id,
+			MessageType: messageType,
+			Sent:        sentFact.Occured,
+			Due:         due.UTC().Format(time.RFC3339Nano),
+			Deliveries:  len(received),
+			sentAt:      sent,
+		}
+
+		if len(received) == 0 {
+			if now.After(due.Add(grace)) {
+				report.Undelivered = append(report.Undelivered, entry)
+			} else {
+				report.Pending++
+			}
+
+			continue
+		}
+
+		report.Delivered++
+
+		first := received[0].Time()
+		entry.Delivered = received[0].Occured
+		entry.LatencyMs = float64(first.Sub(sent)) / float64(time.Millisecond)
+
+		if len(received) > 1 {
+			report.Duplicated = append(report.Duplicated, entry)
+		}
+
+		allowed := defaultTolerance[messageType]
+		if overrideTolerance {
+			allowed = tolerance
+		}
+
+		if first.After(due.Add(allowed)) {
+			report.Late = append(report.Late, entry)
+		}
+	}
+
+	for _, entries := range [][]reconcileEntry{report.Undelivered, report.Duplicated, report.Late} {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].sentAt.Before(entries[j].sentAt)
+		})
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
+
+// unmatched reports whether a message without a sent fact was delivered within the filter's window,
+// facts such as send failures and dead letters which share the ID aren't deliveries
+func unmatched(d *delivery, ff *factFilter) bool {
+	for _, action := range deliveryAction {
+		received := d.received[action]
+		if len(received) == 0 {
+			continue
+		}
+
+		at := received[0].Time()
+		if (ff.since.IsZero() || !at.Before(ff.since)) && (ff.until.IsZero() || at.Before(ff.until)) {
+			return true
+		}
+	}
+
+	return false
+}
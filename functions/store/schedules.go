@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/documents"
+	"github.com/nitrictech/go-sdk/api/errors/codes"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+const maxNextRuns = 100
+
+const defaultRunsLimit = 20
+
+type scheduleInfo struct {
+	common.Schedule
+	Description string         `json:"description"`
+	NextRuns    []string       `json:"nextRuns,omitempty"`
+	LastRun     *common.JobRun `json:"lastRun,omitempty"`
+	LastSuccess *common.JobRun `json:"lastSuccess,omitempty"`
+}
+
+// readJobRuns returns the runs of the schedule, or of every schedule if it is empty, newest first
+func readJobRuns(ctx context.Context, schedule string) ([]*common.JobRun, error) {
+	query := jobRuns.Query()
+	if schedule != "" {
+		query = query.Where(documents.Condition("Schedule").Eq(documents.StringValue(schedule)))
+	}
+
+	iter, err := query.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []*common.JobRun{}
+
+	for {
+		doc, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		run := &common.JobRun{}
+		if err := mapstructure.Decode(doc.Content(), run); err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Start > runs[j].Start
+	})
+
+	return runs, nil
+}
+
+// schedulesGetHandler describes the schedules published by the worker with their last run and last successful run,
+// and the next run times of cron schedules.
+// The number of run times is set by the count query parameter, default 5.
+func schedulesGetHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	count := 5
+	if v := queryParam(hc, "count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxNextRuns {
+			return next(common.HttpResponse(hc, "invalid count "+v+", must be between 0 and "+strconv.Itoa(maxNextRuns), 400))
+		}
+
+		count = n
+	}
+
+	published, err := common.ReadPublishedSchedules(hc.Request.Context(), schedCol)
+	if common.ErrorCode(err) == codes.NotFound {
+		return next(common.HttpResponse(hc, "the worker hasn't published its schedules yet", http.StatusServiceUnavailable))
+	}
+
+	if err != nil {
+		return next(common.HttpResponse(hc, "error reading schedules: "+err.Error(), 500))
+	}
+
+	runs, err := readJobRuns(hc.Request.Context(), "")
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying job runs: "+err.Error(), 500))
+	}
+
+	now := time.Now()
+	infos := make([]scheduleInfo, 0, len(published))
+
+	for _, s := range published {
+		info := scheduleInfo{Schedule: s, Description: s.Describe()}
+
+		// runs are newest first
+		for _, run := range runs {
+			if run.Schedule != s.Name {
+				continue
+			}
+
+			if info.LastRun == nil {
+				info.LastRun = run
+			}
+
+			if run.Status == common.JobSucceeded {
+				info.LastSuccess = run
+				break
+			}
+		}
+
+		// rate schedules run relative to when they were deployed, so only cron run times are known
+		if s.Cron != "" {
+			c, err := s.ParseCron()
+			if err != nil {
+				return next(common.HttpResponse(hc, err.Error(), 500))
+			}
+
+			for _, t := range c.NextN(now, count) {
+				info.NextRuns = append(info.NextRuns, t.Format(time.RFC3339))
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	b, err := json.Marshal(infos)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
+
+// scheduleRunsGetHandler lists the most recent job runs, newest first, optionally of a single schedule.
+// The number of runs is set by the limit query parameter, default 20.
+func scheduleRunsGetHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	limit := defaultRunsLimit
+	if v := queryParam(hc, "limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return next(common.HttpResponse(hc, "invalid limit "+v+", must be a positive integer", 400))
+		}
+
+		limit = n
+	}
+
+	runs, err := readJobRuns(hc.Request.Context(), queryParam(hc, "schedule"))
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying job runs: "+err.Error(), 500))
+	}
+
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	b, err := json.Marshal(runs)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -14,6 +16,150 @@ import (
 	"github.com/nitrictech/test-app/common"
 )
 
+const sendSource = "send"
+
+// sendFact is the data recorded with sent and send failed facts
+type sendFact struct {
+	*common.Message
+	Error string `json:"error,omitempty"`
+}
+
+// sendOutcome returns the fact action and data recording the outcome of sending a message
+func sendOutcome(m *common.Message, sendErr error) (string, string, error) {
+	action := actionSent
+	f := &sendFact{Message: m}
+
+	if sendErr != nil {
+		action = actionSendFailed
+		f.Error = sendErr.Error()
+	}
+
+	b, err := json.Marshal(f)
+
+	return action, string(b), err
+}
+
+// recordSend records the outcome of sending a message, so deliveries can be reconciled against the history
+func recordSend(ctx context.Context, m *common.Message, sendErr error) {
+	action, data, err := sendOutcome(m, sendErr)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := common.RecordFact(ctx, history, sendSource, action, data); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// messagePayload assigns the message an ID if it doesn't have one, and converts it to a payload
+func messagePayload(m *common.Message) (map[string]interface{}, error) {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+
+	mMap := make(map[string]interface{})
+	err := mapstructure.Decode(m, &mMap)
+
+	return mMap, err
+}
+
+// deliveryDelay validates when the message is due, returning how long to wait before delivering it
+func deliveryDelay(m *common.Message, now time.Time) (time.Duration, error) {
+	due, err := m.DueAt(now)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := due.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+
+	messageType := strings.ToLower(m.MessageType)
+	max, err := common.MaxDelay(messageType)
+	if err != nil {
+		return 0, err
+	}
+
+	if delay > max {
+		return 0, fmt.Errorf("delivery in %s exceeds the maximum delay of %s for %s messages on %s", delay, max, messageType, common.Provider())
+	}
+
+	return delay, nil
+}
+
+func publishEvent(ctx context.Context, m *common.Message, payload map[string]interface{}, delay time.Duration) error {
+	_, err := topic.Publish(ctx,
+		&events.Event{
+			ID:          m.ID,
+			PayloadType: m.PayloadType,
+			Payload:     payload,
+		}, events.WithDelay(delay))
+
+	return err
+}
+
+// stageTask holds a queue task in the staged collection, the worker sends it to the queue once it is due
+func stageTask(ctx context.Context, m *common.Message, payload map[string]interface{}, due time.Time) error {
+	st := &common.StagedTask{
+		ID:          m.ID,
+		Due:         due.UnixMicro(),
+		PayloadType: m.PayloadType,
+		Payload:     payload,
+	}
+
+	stMap := make(map[string]interface{})
+	if err := mapstructure.Decode(st, &stMap); err != nil {
+		return err
+	}
+
+	return staged.Doc(st.ID).Set(ctx, stMap)
+}
+
+func queueTask(m *common.Message, payload map[string]interface{}) *queues.Task {
+	return &queues.Task{
+		ID:          m.ID,
+		PayloadType: m.PayloadType,
+		Payload:     payload,
+	}
+}
+
+type failedTask struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type sendFailure struct {
+	ID     string       `json:"id"`
+	Failed []failedTask `json:"failed"`
+}
+
+// failedTasksResponse reports tasks the queue refused with a 502, recording the failure in the history
+func failedTasksResponse(hc *faas.HttpContext, m *common.Message, failed []*queues.FailedTask) *faas.HttpContext {
+	res := &sendFailure{ID: m.ID, Failed: make([]failedTask, 0, len(failed))}
+	reasons := make([]string, 0, len(failed))
+
+	for _, ft := range failed {
+		res.Failed = append(res.Failed, failedTask{ID: ft.Task.ID, Reason: ft.Reason})
+		reasons = append(reasons, ft.Reason)
+	}
+
+	recordSend(hc.Request.Context(), m, fmt.Errorf("queue rejected task: %s", strings.Join(reasons, "; ")))
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return common.HttpResponse(hc, err.Error(), http.StatusInternalServerError)
+	}
+
+	fmt.Printf("failed to send message id %s: %v\n", m.ID, reasons)
+	hc.Response.Status = http.StatusBadGateway
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return hc
+}
+
 func sendPostHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
 	fmt.Println("sendPostHandler")
 	m := &common.Message{}
@@ -21,43 +167,64 @@ func sendPostHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpCon
 		return next(common.HttpResponse(hc, "error decoding json body", 400))
 	}
 
-	if m.ID == "" {
-		m.ID = uuid.New().String()
+	if _, err := m.DecodePayload(); err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
 	}
 
-	mMap := make(map[string]interface{})
-
-	err := mapstructure.Decode(m, &mMap)
+	mMap, err := messagePayload(m)
 	if err != nil {
 		return next(common.HttpResponse(hc, "error decoding message document", 400))
 	}
 
+	now := time.Now()
+
+	delay, err := deliveryDelay(m, now)
+	if err != nil {
+		recordSend(hc.Request.Context(), m, err)
+		return next(common.HttpResponse(hc, "error sending:"+err.Error(), 400))
+	}
+
 	switch strings.ToLower(m.MessageType) {
 	case "topic":
-		_, err = topic.Publish(hc.Request.Context(),
-			&events.Event{
-				ID:          m.ID,
-				PayloadType: m.PayloadType,
-				Payload:     mMap,
-			}, events.WithDelay(time.Duration(m.Delay)*time.Second))
+		err = publishEvent(hc.Request.Context(), m, mMap, delay)
 	case "queue":
-		_, err = queue.Send(hc.Request.Context(), []*queues.Task{
-			{
-				ID:          m.ID,
-				PayloadType: m.PayloadType,
-				Payload:     mMap,
-			},
-		})
+		if delay > 0 {
+			err = stageTask(hc.Request.Context(), m, mMap, now.Add(delay))
+			break
+		}
+
+		var failed []*queues.FailedTask
+
+		failed, err = queue.Send(hc.Request.Context(), []*queues.Task{queueTask(m, mMap)})
+		if err == nil && len(failed) > 0 {
+			return next(failedTasksResponse(hc, m, failed))
+		}
 	default:
 		err = fmt.Errorf("unknown message type %s", m.MessageType)
 	}
 	if err != nil {
+		recordSend(hc.Request.Context(), m, err)
 		return next(common.HttpResponse(hc, "error sending:"+err.Error(), 400))
 	}
 
+	recordSend(hc.Request.Context(), m, nil)
+
 	fmt.Printf("sent message id %s", m.ID)
 	hc.Response.Status = 200
 	hc.Response.Body = []byte(fmt.Sprintf("Run action : %v", m))
 
 	return next(hc)
 }
+
+// payloadTypesGetHandler lists the registered payload types with their JSON Schema
+func payloadTypesGetHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	b, err := json.Marshal(common.PayloadTypes())
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
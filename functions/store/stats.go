@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// fact actions which mark the two ends of a message delivery
+const (
+	actionSent          = "sent"
+	actionSendFailed    = "send failed"
+	actionReceivedEvent = "received event"
+	actionTaskComplete  = "task complete"
+)
+
+var deliveryActions = []string{actionReceivedEvent, actionTaskComplete}
+
+// messageID returns the ID of the message recorded in the fact data, if there is one
+func messageID(f *common.Fact) string {
+	m := struct {
+		ID string `json:"id"`
+	}{}
+
+	if err := json.Unmarshal([]byte(f.Data), &m); err != nil {
+		return ""
+	}
+
+	return m.ID
+}
+
+// delivery groups the sent and received facts for a single message
+type delivery struct {
+	sent     []common.Fact
+	received map[string][]common.Fact
+}
+
+// deliveries groups facts which carry a message ID by that ID
+func deliveries(facts []common.Fact) map[string]*delivery {
+	ds := map[string]*delivery{}
+
+	for _, f := range facts {
+		id := messageID(&f)
+		if id == "" {
+			continue
+		}
+
+		d, ok := ds[id]
+		if !ok {
+			d = &delivery{received: map[string][]common.Fact{}}
+			ds[id] = d
+		}
+
+		if f.Action == actionSent {
+			d.sent = append(d.sent, f)
+		} else {
+			d.received[f.Action] = append(d.received[f.Action], f)
+		}
+	}
+
+	for _, d := range ds {
+		common.SortFacts(d.sent)
+
+		for _, r := range d.received {
+			common.SortFacts(r)
+		}
+	}
+
+	return ds
+}
+
+type factCount struct {
+	Source string `json:"source"`
+	Action string `json:"action"`
+	Count  int    `json:"count"`
+}
+
+// latencyStats are in milliseconds
+type latencyStats struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	Max   float64 `json:"max"`
+}
+
+type historyStats struct {
+	Since   string                   `json:"since,omitempty"`
+	Until   string                   `json:"until,omitempty"`
+	Total   int                      `json:"total"`
+	Counts  []factCount              `json:"counts"`
+	Latency map[string]*latencyStats `json:"latency"`
+}
+
+func newLatencyStats(latencies []time.Duration) *latencyStats {
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	// nearest rank percentile
+	percentile := func(p float64) float64 {
+		i := int(p*float64(len(latencies))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+
+		return ms(latencies[i])
+	}
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+
+	return &latencyStats{
+		Count: len(latencies),
+		Min:   ms(latencies[0]),
+		Mean:  ms(total / time.Duration(len(latencies))),
+		P50:   percentile(0.5),
+		P95:   percentile(0.95),
+		Max:   ms(latencies[len(latencies)-1]),
+	}
+}
+
+// historyStatsHandler counts facts by source and action, and measures the time from a message
+// being sent to each kind of delivery, for facts matching the same filters as GET /history
+func historyStatsHandler(hc *faas.HttpContext, next faas.HttpHandler) (*faas.HttpContext, error) {
+	ff, err := parseFactFilter(hc)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 400))
+	}
+
+	facts, err := ff.read(hc.Request.Context())
+	if err != nil {
+		return next(common.HttpResponse(hc, "error querying collection: "+err.Error(), 500))
+	}
+
+	stats := &historyStats{
+		Total:   len(facts),
+		Counts:  []factCount{},
+		Latency: map[string]*latencyStats{},
+	}
+
+	if !ff.since.IsZero() {
+		stats.Since = ff.since.Format(time.RFC3339Nano)
+	}
+
+	if !ff.until.IsZero() {
+		stats.Until = ff.until.Format(time.RFC3339Nano)
+	}
+
+	counts := map[factCount]int{}
+	for _, f := range facts {
+		counts[factCount{Source: f.Source, Action: f.Action}]++
+	}
+
+	for fc, n := range counts {
+		fc.Count = n
+		stats.Counts = append(stats.Counts, fc)
+	}
+
+	sort.Slice(stats.Counts, func(i, j int) bool {
+		a, b := stats.Counts[i], stats.Counts[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+
+		return a.Action < b.Action
+	})
+
+	latencies := map[string][]time.Duration{}
+
+	for _, d := range deliveries(facts) {
+		if len(d.sent) == 0 {
+			continue
+		}
+
+		sent := d.sent[0].Time()
+
+		for _, action := range deliveryActions {
+			for _, r := range d.received[action] {
+				latencies[action] = append(latencies[action], r.Time().Sub(sent))
+			}
+		}
+	}
+
+	for action, ls := range latencies {
+		stats.Latency[action] = newLatencyStats(ls)
+	}
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return next(common.HttpResponse(hc, err.Error(), 500))
+	}
+
+	hc.Response.Body = b
+	hc.Response.Headers["Content-Type"] = []string{"application/json"}
+
+	return next(hc)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/queues"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// eventHandler dispatches messages published to the topic, suppressing those which have already been processed.
+// Events which fail are redelivered until they are dead lettered, like queue tasks.
+func eventHandler(ec *faas.EventContext, next faas.EventHandler) (*faas.EventContext, error) {
+	fmt.Printf("received on %s mesg %s", ec.Request.Topic(), string(ec.Request.Data()))
+
+	ctx := ec.Request.Context()
+	action := "received event"
+	data := string(ec.Request.Data())
+
+	msg := &common.Message{}
+	if err := json.Unmarshal(ec.Request.Data(), msg); err != nil {
+		fmt.Println(err)
+	} else if dup, ok := dedup.duplicate(ctx, ec.Request.Topic(), msg.ID); ok {
+		action, data = actionDuplicateSuppressed, dup
+	} else if err := router.Dispatch(ctx, ec.Request.Topic(), msg); err != nil {
+		fmt.Println(err)
+
+		dead, dlqErr := eventFailed(ctx, ec.Request.Topic(), msg, err)
+		if dlqErr != nil {
+			fmt.Println(dlqErr)
+		}
+
+		// nack the event so it is redelivered, unless it was dead lettered
+		ec.Response.Success = dead
+
+		return next(ec)
+	}
+
+	err := common.RecordFact(ctx, history, ec.Request.Topic(), action, data)
+	if err != nil {
+		// nack the event so it is redelivered rather than lost from the history
+		fmt.Println(err)
+		ec.Response.Success = false
+
+		return next(ec)
+	}
+
+	if action != actionDuplicateSuppressed {
+		dedup.markProcessed(ctx, ec.Request.Topic(), msg.ID)
+	}
+
+	return next(ec)
+}
+
+// processedTask is a task which was handled, or suppressed as a duplicate, with the fact recording it
+type processedTask struct {
+	fact *common.Fact
+	// messageID is remembered as processed once the fact is written, empty for duplicates
+	messageID string
+}
+
+// processTask dispatches a task, buffering its completion fact in the recorder when it succeeds.
+// A task which fails after ctx is done is left for the caller to count, as ctx can't be used to count it.
+func processTask(ctx context.Context, recorder *common.FactRecorder, task queues.ReceivedTask) (*processedTask, error) {
+	msg := &common.Message{}
+	err := mapstructure.Decode(task.Task().Payload, msg)
+	if err == nil {
+		// already processed tasks are completed without handling them again
+		if dup, ok := dedup.duplicate(ctx, queue.Name(), msg.ID); ok {
+			fact, err := recorder.Record(ctx, queue.Name(), actionDuplicateSuppressed, dup)
+			if err != nil {
+				return nil, err
+			}
+
+			return &processedTask{fact: fact}, nil
+		}
+
+		err = retryTask(ctx, task.Task().ID, stageHandle, func() error {
+			return router.Dispatch(ctx, queue.Name(), msg)
+		})
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		if dlqErr := taskFailed(ctx, task, err); dlqErr != nil {
+			fmt.Println(dlqErr)
+		}
+
+		return nil, err
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	fact, err := recorder.Record(ctx, queue.Name(), "task complete", string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return &processedTask{fact: fact, messageID: msg.ID}, nil
+}
+
+const actionCompleteFailed = "complete failed"
+
+// completeFailedFact is the data recorded with complete failed facts
+type completeFailedFact struct {
+	ID    string `json:"id"`
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// completeTask completes a task which was handled, retrying transient failures. The task complete fact is
+// recorded before the task is completed, so a completion which fails is recorded too, otherwise the history
+// would show a completion which never happened.
+func completeTask(ctx context.Context, task queues.ReceivedTask) error {
+	taskSucceeded(ctx, task)
+
+	err := retryTask(ctx, task.Task().ID, stageComplete, func() error {
+		return task.Complete(ctx)
+	})
+	if err == nil {
+		return nil
+	}
+
+	fmt.Printf("error completing task %s (%s): %v\n", task.Task().ID, common.ErrorCode(err), err)
+
+	b, jsonErr := json.Marshal(&completeFailedFact{ID: task.Task().ID, Code: common.ErrorCode(err).String(), Error: err.Error()})
+	if jsonErr != nil {
+		fmt.Println(jsonErr)
+		return err
+	}
+
+	if factErr := common.RecordFact(ctx, history, queue.Name(), actionCompleteFailed, string(b)); factErr != nil {
+		fmt.Println(factErr)
+	}
+
+	return err
+}
+
+// batchResult counts the outcome of the tasks processed by a job, e.g. from the queue
+type batchResult struct {
+	received  int
+	completed int
+	failed    int
+	// skipped tasks weren't started before the drain deadline, they are redelivered
+	skipped int
+}
+
+func (r *batchResult) add(o batchResult) {
+	r.received += o.received
+	r.completed += o.completed
+	r.failed += o.failed
+	r.skipped += o.skipped
+}
+
+// processBatch handles the tasks in parallel, completing those which succeed.
+// Tasks which haven't started by the deadline are skipped, unless it is zero.
+func processBatch(ctx context.Context, tasks []queues.ReceivedTask, deadline time.Time) (batchResult, error) {
+	res := batchResult{received: len(tasks)}
+
+	// record the completions as one batch, then only complete tasks whose completion was recorded,
+	// leaving the others to be redelivered
+	recorder := common.NewFactRecorder(history, common.WithBatchSize(0))
+	processed := make([]*processedTask, len(tasks))
+
+	// run waits for every call, so each result is only written by the goroutine processing its task
+	processErrs := pool.run(ctx, len(tasks), func(ctx context.Context, i int) error {
+		if passed(deadline) {
+			return errDrainDeadline
+		}
+
+		pt, err := processTask(ctx, recorder, tasks[i])
+		processed[i] = pt
+
+		return err
+	})
+
+	// tasks which timed out are counted as failed here, as their own context has expired
+	for i, err := range processErrs {
+		var timeout *taskTimeoutError
+		if !errors.As(err, &timeout) {
+			continue
+		}
+
+		if dlqErr := taskFailed(ctx, tasks[i], err); dlqErr != nil {
+			fmt.Println(dlqErr)
+		}
+	}
+
+	failed := map[string]error{}
+	if err := recorder.Close(ctx); err != nil {
+		if flushErr, ok := err.(*common.FlushError); ok {
+			failed = flushErr.Failed
+		}
+	}
+
+	completeErrs := pool.run(ctx, len(tasks), func(ctx context.Context, i int) error {
+		if processed[i] == nil || processErrs[i] != nil {
+			return nil
+		}
+
+		if err, ok := failed[processed[i].fact.ID]; ok {
+			return err
+		}
+
+		// only remember the message once its completion is in the history, so a redelivery after
+		// the fact failed to write is handled again rather than suppressed
+		dedup.markProcessed(ctx, queue.Name(), processed[i].messageID)
+
+		return completeTask(ctx, tasks[i])
+	})
+
+	for i := range tasks {
+		switch {
+		case processErrs[i] == errDrainDeadline:
+			res.skipped++
+			processErrs[i] = nil
+		case processErrs[i] != nil || completeErrs[i] != nil:
+			res.failed++
+		default:
+			res.completed++
+		}
+	}
+
+	return res, combineErrors(processErrs, completeErrs)
+}
+
+// consumeQueue receives batches of tasks from the queue until it is empty or the drain deadline has passed
+func consumeQueue(ctx context.Context) (batchResult, error) {
+	start := time.Now()
+	deadline := drain.deadline(ctx, start)
+	total := batchResult{}
+
+	// tasks received once the deadline has passed would only be redelivered
+	for !passed(deadline) {
+		tasks, err := queue.Receive(ctx, drain.batchSize)
+		if err != nil {
+			return total, err
+		}
+
+		fmt.Printf("got (%d) tasks\n", len(tasks))
+
+		res, err := processBatch(ctx, tasks, deadline)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		total.add(res)
+
+		if !drain.more(deadline, len(tasks)) {
+			break
+		}
+	}
+
+	fmt.Printf("drained (%d) tasks in %s, (%d) completed, (%d) failed, (%d) skipped\n",
+		total.received, time.Since(start), total.completed, total.failed, total.skipped)
+
+	return total, nil
+}
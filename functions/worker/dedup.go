@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/documents"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+const actionDuplicateSuppressed = "duplicate suppressed"
+
+// processedMessage records that a message was handled, until ExpiresAt (unix microseconds)
+type processedMessage struct {
+	ID          string
+	Channel     string
+	ProcessedAt int64
+	ExpiresAt   int64
+}
+
+// duplicateFact is the data recorded with duplicate suppressed facts
+type duplicateFact struct {
+	ID          string `json:"id"`
+	Channel     string `json:"channel"`
+	Provider    string `json:"provider"`
+	ProcessedAt string `json:"processedAt"`
+}
+
+// dedupStore remembers the IDs of processed messages on each channel for ttl, so redelivered messages are only handled once.
+// A zero ttl disables de-duplication.
+type dedupStore struct {
+	col documents.CollectionRef
+	ttl time.Duration
+}
+
+// dedupStoreFromEnv reads DEDUP_TTL (e.g. "24h")
+func dedupStoreFromEnv(col documents.CollectionRef) (*dedupStore, error) {
+	d := &dedupStore{col: col, ttl: 24 * time.Hour}
+
+	if v := os.Getenv("DEDUP_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid DEDUP_TTL %s, must be a non negative duration", v)
+		}
+
+		d.ttl = ttl
+	}
+
+	return d, nil
+}
+
+// key is the document id of a message, as message IDs are only unique on their channel
+func (d *dedupStore) key(channel, id string) string {
+	return channel + ":" + id
+}
+
+// seen returns the record of the message being processed on the channel, or nil if it hasn't been or the record has expired
+func (d *dedupStore) seen(ctx context.Context, channel, id string) *processedMessage {
+	if d.ttl == 0 || id == "" {
+		return nil
+	}
+
+	doc, err := d.col.Doc(d.key(channel, id)).Get(ctx)
+	if err != nil {
+		return nil
+	}
+
+	pm := &processedMessage{}
+	if err := mapstructure.Decode(doc.Content(), pm); err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	if pm.ExpiresAt <= time.Now().UnixMicro() {
+		return nil
+	}
+
+	return pm
+}
+
+// duplicate returns the data for a duplicate suppressed fact if the message has already been processed
+func (d *dedupStore) duplicate(ctx context.Context, channel, id string) (string, bool) {
+	pm := d.seen(ctx, channel, id)
+	if pm == nil {
+		return "", false
+	}
+
+	fmt.Printf("suppressed duplicate message id %s on %s\n", id, channel)
+
+	b, err := json.Marshal(&duplicateFact{
+		ID:          id,
+		Channel:     channel,
+		Provider:    common.Provider(),
+		ProcessedAt: time.UnixMicro(pm.ProcessedAt).UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	return string(b), true
+}
+
+// markProcessed remembers the message was processed. Failing to is only logged, at worst the message is handled twice.
+func (d *dedupStore) markProcessed(ctx context.Context, channel, id string) {
+	if d.ttl == 0 || id == "" {
+		return
+	}
+
+	now := time.Now()
+	pm := &processedMessage{
+		ID:          id,
+		Channel:     channel,
+		ProcessedAt: now.UnixMicro(),
+		ExpiresAt:   now.Add(d.ttl).UnixMicro(),
+	}
+
+	pmMap := make(map[string]interface{})
+	if err := mapstructure.Decode(pm, &pmMap); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := d.col.Doc(d.key(channel, id)).Set(ctx, pmMap); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// expire deletes the records which have outlived the ttl
+func (d *dedupStore) expire(ctx context.Context) (int, error) {
+	now := time.Now().UnixMicro()
+
+	results, err := d.col.Query().Where(documents.Condition("ExpiresAt").Le(documents.NumberValue(int(now)))).Fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+
+	for _, doc := range results.Documents {
+		if err := doc.Ref().Delete(ctx); err != nil {
+			fmt.Printf("error expiring processed message %s: %v\n", doc.Ref().Id(), err)
+			continue
+		}
+
+		expired++
+	}
+
+	return expired, nil
+}
+
+// expireJob counts the expired records as completed
+func (d *dedupStore) expireJob(ctx context.Context) (batchResult, error) {
+	expired, err := d.expire(ctx)
+	if err != nil {
+		return batchResult{}, err
+	}
+
+	fmt.Printf("expired (%d) processed messages\n", expired)
+
+	return batchResult{received: expired, completed: expired}, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/queues"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func TestDedupKeyedByChannel(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	setupWorker(t)
+
+	dedup.markProcessed(ctx, "ping", "same-id")
+
+	_, ok := dedup.duplicate(ctx, "ping", "same-id")
+	g.Expect(ok).To(BeTrue())
+
+	_, ok = dedup.duplicate(ctx, queue.Name(), "same-id")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestDedupExpired(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	setupWorker(t)
+	dedup.ttl = time.Millisecond
+
+	dedup.markProcessed(ctx, "ping", "expiring")
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok := dedup.duplicate(ctx, "ping", "expiring")
+	g.Expect(ok).To(BeFalse())
+
+	expired, err := dedup.expire(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(expired).To(Equal(1))
+}
+
+func TestProcessBatchMarksProcessedOnceRecorded(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := setupWorker(t)
+	msg := &common.Message{ID: "recorded", MessageType: "queue", PayloadType: common.PayloadTypeNone, Payload: "hi"}
+
+	// the task complete fact fails to write, so the task is left to be redelivered and not remembered
+	srv.SetHook(func(op, collection, id string) error {
+		if op == "set" && collection == "history" {
+			return errors.New("unavailable")
+		}
+
+		return nil
+	})
+
+	first := newTask(t, msg)
+	res, err := processBatch(ctx, []queues.ReceivedTask{first}, time.Time{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(res.failed).To(Equal(1))
+	g.Expect(first.Completed()).To(Equal(0))
+	g.Expect(srv.Docs("processed")).To(BeEmpty())
+
+	srv.SetHook(nil)
+
+	// the redelivery is handled again rather than suppressed as a duplicate
+	redelivered := newTask(t, msg)
+	res, err = processBatch(ctx, []queues.ReceivedTask{redelivered}, time.Time{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.completed).To(Equal(1))
+	g.Expect(redelivered.Completed()).To(Equal(1))
+	g.Expect(factsFrom(t, queue.Name(), "task complete")).To(HaveLen(1))
+	g.Expect(srv.Docs("processed")).To(HaveKey(queue.Name() + ":recorded"))
+
+	// a further redelivery is suppressed
+	again := newTask(t, msg)
+	_, err = processBatch(ctx, []queues.ReceivedTask{again}, time.Time{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(again.Completed()).To(Equal(1))
+	g.Expect(factsFrom(t, queue.Name(), actionDuplicateSuppressed)).To(HaveLen(1))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// delivery is a message received by the worker from the topic or the queue
+type delivery struct {
+	// Source is the name of the topic or queue the message arrived on
+	Source  string
+	Message *common.Message
+	// Payload is the message payload decoded into its registered type,
+	// nil when the payload type isn't registered
+	Payload interface{}
+}
+
+type payloadHandler func(ctx context.Context, d *delivery) error
+
+// dispatcher routes deliveries to the handler registered for their payload type
+type dispatcher struct {
+	handlers map[string]payloadHandler
+	fallback payloadHandler
+}
+
+// newDispatcher returns a dispatcher which sends deliveries with no registered handler to fallback
+func newDispatcher(fallback payloadHandler) *dispatcher {
+	return &dispatcher{
+		handlers: map[string]payloadHandler{},
+		fallback: fallback,
+	}
+}
+
+// Handle registers the handler for a payload type, replacing any existing handler
+func (d *dispatcher) Handle(payloadType string, h payloadHandler) {
+	d.handlers[payloadType] = h
+}
+
+// Dispatch decodes the message payload and calls the handler for its type
+func (d *dispatcher) Dispatch(ctx context.Context, source string, msg *common.Message) error {
+	del := &delivery{Source: source, Message: msg}
+
+	payload, err := msg.DecodePayload()
+
+	var unknown *common.ErrUnknownPayloadType
+	if err != nil && !errors.As(err, &unknown) {
+		return err
+	}
+
+	del.Payload = payload
+
+	h, ok := d.handlers[msg.PayloadType]
+	if !ok || del.Payload == nil {
+		h = d.fallback
+	}
+
+	if err := h(ctx, del); err != nil {
+		return fmt.Errorf("handling %s message %s: %w", msg.PayloadType, msg.ID, err)
+	}
+
+	return nil
+}
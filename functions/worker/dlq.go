@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/queues"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+const defaultMaxAttempts = 5
+
+// maxAttempts is the number of failed deliveries before a task is dead lettered, from DLQ_MAX_ATTEMPTS
+func maxAttempts() int {
+	if v := os.Getenv("DLQ_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+
+		fmt.Printf("invalid DLQ_MAX_ATTEMPTS %s, using %d\n", v, defaultMaxAttempts)
+	}
+
+	return defaultMaxAttempts
+}
+
+// countFailure adds a failed delivery to the attempts with the ID, reporting whether they have reached maxAttempts.
+// Otherwise the attempts are saved.
+func countFailure(ctx context.Context, id string, reason error) (*common.TaskAttempts, bool, error) {
+	ta := &common.TaskAttempts{ID: id}
+	if doc, err := attempts.Doc(id).Get(ctx); err == nil {
+		if err := mapstructure.Decode(doc.Content(), ta); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	ta.Attempts++
+	ta.LastError = reason.Error()
+
+	if ta.Attempts >= maxAttempts() {
+		return ta, true, nil
+	}
+
+	taMap := make(map[string]interface{})
+	if err := mapstructure.Decode(ta, &taMap); err != nil {
+		return ta, false, err
+	}
+
+	return ta, false, attempts.Doc(id).Set(ctx, taMap)
+}
+
+// deadLetter writes the dead letter to the work-dlq collection
+func deadLetter(ctx context.Context, dl *common.DeadLetter) error {
+	dl.DeadAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	dlMap := make(map[string]interface{})
+	if err := mapstructure.Decode(dl, &dlMap); err != nil {
+		return err
+	}
+
+	return dlq.Doc(dl.ID).Set(ctx, dlMap)
+}
+
+// deadLettered forgets the attempts of a dead letter, recording it in the history from the source
+func deadLettered(ctx context.Context, source string, dl *common.DeadLetter) error {
+	if err := attempts.Doc(dl.ID).Delete(ctx); err != nil {
+		fmt.Println(err)
+	}
+
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	return common.RecordFact(ctx, history, source, "dead lettered", string(b))
+}
+
+// taskFailed counts a failed delivery of the task, moving it to the dead letter collection and completing it
+// once it has failed maxAttempts times. Otherwise the task is left to be redelivered.
+func taskFailed(ctx context.Context, task queues.ReceivedTask, reason error) error {
+	ta, exhausted, err := countFailure(ctx, task.Task().ID, reason)
+	if err != nil || !exhausted {
+		return err
+	}
+
+	dl := &common.DeadLetter{
+		ID:          ta.ID,
+		MessageID:   task.Task().ID,
+		Queue:       task.Queue(),
+		PayloadType: task.Task().PayloadType,
+		Payload:     task.Task().Payload,
+		Reason:      reason.Error(),
+		Attempts:    ta.Attempts,
+	}
+
+	if err := deadLetter(ctx, dl); err != nil {
+		return err
+	}
+
+	if err := task.Complete(ctx); err != nil {
+		return err
+	}
+
+	return deadLettered(ctx, task.Queue(), dl)
+}
+
+const actionEventFailed = "event failed"
+
+// eventFailedFact is the data recorded with event failed facts
+type eventFailedFact struct {
+	ID      string `json:"id"`
+	Topic   string `json:"topic"`
+	Attempt int    `json:"attempt"`
+	Error   string `json:"error"`
+}
+
+// eventFailed records a failed delivery of a topic event and counts it, moving the event to the dead letter
+// collection once it has failed maxAttempts times. Returns whether the event was dead lettered, so it can be
+// acknowledged, otherwise it should be left to be redelivered.
+func eventFailed(ctx context.Context, topicName string, msg *common.Message, reason error) (bool, error) {
+	ta, exhausted, err := countFailure(ctx, topicName+":"+msg.ID, reason)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := json.Marshal(&eventFailedFact{ID: msg.ID, Topic: topicName, Attempt: ta.Attempts, Error: reason.Error()})
+	if err != nil {
+		return false, err
+	}
+
+	if err := common.RecordFact(ctx, history, topicName, actionEventFailed, string(b)); err != nil {
+		fmt.Println(err)
+	}
+
+	if !exhausted {
+		return false, nil
+	}
+
+	payload := make(map[string]interface{})
+	if err := mapstructure.Decode(msg, &payload); err != nil {
+		return false, err
+	}
+
+	dl := &common.DeadLetter{
+		ID:          ta.ID,
+		MessageID:   msg.ID,
+		Topic:       topicName,
+		PayloadType: msg.PayloadType,
+		Payload:     payload,
+		Reason:      reason.Error(),
+		Attempts:    ta.Attempts,
+	}
+
+	if err := deadLetter(ctx, dl); err != nil {
+		return false, err
+	}
+
+	return true, deadLettered(ctx, topicName, dl)
+}
+
+// taskSucceeded forgets the failed deliveries of a task
+func taskSucceeded(ctx context.Context, task queues.ReceivedTask) {
+	// most tasks never failed, so there is nothing to delete
+	_ = attempts.Doc(task.Task().ID).Delete(ctx)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/queues"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// failNone makes every None payload fail to be handled
+func failNone() {
+	router.Handle(common.PayloadTypeNone, func(ctx context.Context, d *delivery) error {
+		return errors.New("poison")
+	})
+}
+
+func TestEventDeadLetteredAfterMaxAttempts(t *testing.T) {
+	g := NewGomegaWithT(t)
+	t.Setenv("DLQ_MAX_ATTEMPTS", "3")
+
+	srv := setupWorker(t)
+	failNone()
+
+	msg := &common.Message{ID: "poison", MessageType: "topic", PayloadType: common.PayloadTypeNone, Payload: "boom"}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		ec, err := eventHandler(newEvent(t, "ping", msg), handled)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// redelivered until the last attempt dead letters it
+		g.Expect(ec.Response.Success).To(Equal(attempt == 3))
+		g.Expect(factsFrom(t, "ping", actionEventFailed)).To(HaveLen(attempt))
+	}
+
+	g.Expect(srv.Docs("attempts")).To(BeEmpty())
+	g.Expect(srv.Docs("work-dlq")).To(HaveKey("ping:poison"))
+
+	dl := srv.Docs("work-dlq")["ping:poison"]
+	g.Expect(dl["Topic"]).To(Equal("ping"))
+	g.Expect(dl["MessageID"]).To(Equal("poison"))
+	g.Expect(dl["Attempts"]).To(BeEquivalentTo(3))
+	g.Expect(dl["Reason"]).To(ContainSubstring("poison"))
+	g.Expect(dl["Payload"]).To(HaveKeyWithValue("ID", "poison"))
+
+	g.Expect(factsFrom(t, "ping", "dead lettered")).To(HaveLen(1))
+	g.Expect(factsFrom(t, "ping", "received event")).To(BeEmpty())
+}
+
+func TestTaskDeadLetteredAfterMaxAttempts(t *testing.T) {
+	g := NewGomegaWithT(t)
+	t.Setenv("DLQ_MAX_ATTEMPTS", "2")
+
+	srv := setupWorker(t)
+	failNone()
+
+	msg := &common.Message{ID: "poison", MessageType: "queue", PayloadType: common.PayloadTypeNone, Payload: "boom"}
+
+	first := newTask(t, msg)
+	_, err := processBatch(context.Background(), []queues.ReceivedTask{first}, time.Time{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(first.Completed()).To(Equal(0))
+	g.Expect(srv.Docs("attempts")["poison"]["Attempts"]).To(BeEquivalentTo(1))
+
+	second := newTask(t, msg)
+	_, err = processBatch(context.Background(), []queues.ReceivedTask{second}, time.Time{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(second.Completed()).To(Equal(1))
+
+	g.Expect(srv.Docs("attempts")).To(BeEmpty())
+	g.Expect(srv.Docs("work-dlq")).To(HaveKey("poison"))
+	g.Expect(srv.Docs("work-dlq")["poison"]["Queue"]).To(Equal(queue.Name()))
+	g.Expect(srv.Docs("work-dlq")["poison"]["MessageID"]).To(Equal("poison"))
+	g.Expect(factsFrom(t, queue.Name(), "dead lettered")).To(HaveLen(1))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// drainHeadroom is left before the function times out, to finish the tasks in progress and record the run
+const drainHeadroom = time.Minute
+
+// errDrainDeadline is the error of a task which wasn't started, as draining had run out of time
+var errDrainDeadline = errors.New("drain deadline passed before the task started")
+
+// drainPolicy controls how the queue consumer receives tasks on each schedule tick
+type drainPolicy struct {
+	batchSize int
+	// budget is how long to keep receiving batches for, zero receives a single batch
+	budget time.Duration
+}
+
+// drainPolicyFromEnv reads RECEIVE_BATCH_SIZE, FUNCTION_TIMEOUT (default "5m") and DRAIN_BUDGET (e.g. "4m").
+// The default budget is the function timeout less a minute of headroom.
+func drainPolicyFromEnv() (*drainPolicy, error) {
+	p := &drainPolicy{
+		batchSize: 10,
+	}
+
+	var err error
+
+	if v := os.Getenv("RECEIVE_BATCH_SIZE"); v != "" {
+		p.batchSize, err = strconv.Atoi(v)
+		if err != nil || p.batchSize < 1 {
+			return nil, fmt.Errorf("invalid RECEIVE_BATCH_SIZE %s, must be a positive integer", v)
+		}
+	}
+
+	timeout := 5 * time.Minute
+
+	if v := os.Getenv("FUNCTION_TIMEOUT"); v != "" {
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout <= drainHeadroom {
+			return nil, fmt.Errorf("invalid FUNCTION_TIMEOUT %s, must be a duration longer than %s", v, drainHeadroom)
+		}
+	}
+
+	p.budget = timeout - drainHeadroom
+
+	if v := os.Getenv("DRAIN_BUDGET"); v != "" {
+		p.budget, err = time.ParseDuration(v)
+		if err != nil || p.budget < 0 {
+			return nil, fmt.Errorf("invalid DRAIN_BUDGET %s, must be a non negative duration", v)
+		}
+	}
+
+	return p, nil
+}
+
+// deadline returns when draining which started at start should stop starting tasks, when the budget is spent
+// or the headroom before the context's deadline is reached, whichever is first. It is zero when there is no limit.
+func (p *drainPolicy) deadline(ctx context.Context, start time.Time) time.Time {
+	deadline := time.Time{}
+	if p.budget > 0 {
+		deadline = start.Add(p.budget)
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		if d = d.Add(-drainHeadroom); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+
+	return deadline
+}
+
+// more reports whether another batch should be received, given the drain deadline and the size of the last batch
+func (p *drainPolicy) more(deadline time.Time, received int) bool {
+	if p.budget == 0 || received == 0 {
+		return false
+	}
+
+	return deadline.IsZero() || time.Now().Before(deadline)
+}
+
+// passed reports whether the drain deadline has passed, a zero deadline never passes
+func passed(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
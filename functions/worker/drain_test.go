@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/queues"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func TestDrainPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		budget  string
+		want    time.Duration
+		err     string
+	}{
+		{name: "default", want: 4 * time.Minute},
+		{name: "function timeout", timeout: "15m", want: 14 * time.Minute},
+		{name: "budget overrides the timeout", timeout: "15m", budget: "2m", want: 2 * time.Minute},
+		{name: "single batch", budget: "0", want: 0},
+		{name: "timeout within the headroom", timeout: "30s", err: "invalid FUNCTION_TIMEOUT"},
+		{name: "invalid budget", budget: "-1m", err: "invalid DRAIN_BUDGET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+			t.Setenv("FUNCTION_TIMEOUT", tt.timeout)
+			t.Setenv("DRAIN_BUDGET", tt.budget)
+
+			p, err := drainPolicyFromEnv()
+			if tt.err != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.err)))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(p.budget).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	start := time.Now()
+	p := &drainPolicy{batchSize: 10, budget: 4 * time.Minute}
+
+	g.Expect(p.deadline(context.Background(), start)).To(Equal(start.Add(4 * time.Minute)))
+
+	// a context deadline sooner than the budget, less the headroom
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(3*time.Minute))
+	defer cancel()
+	g.Expect(p.deadline(ctx, start)).To(Equal(start.Add(2 * time.Minute)))
+
+	// a single batch still stops starting tasks near the context deadline
+	single := &drainPolicy{batchSize: 10}
+	g.Expect(single.deadline(context.Background(), start).IsZero()).To(BeTrue())
+	g.Expect(single.deadline(ctx, start)).To(Equal(start.Add(2 * time.Minute)))
+	g.Expect(single.more(time.Time{}, 10)).To(BeFalse())
+
+	g.Expect(p.more(time.Time{}, 10)).To(BeTrue())
+	g.Expect(p.more(start.Add(time.Minute), 0)).To(BeFalse())
+	g.Expect(p.more(start.Add(-time.Second), 10)).To(BeFalse())
+}
+
+func TestProcessBatchSkipsTasksAfterDeadline(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	setupWorker(t)
+	pool.concurrency = 1
+
+	router.Handle(common.PayloadTypeNone, func(ctx context.Context, d *delivery) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+
+	tasks := []queues.ReceivedTask{}
+	for i := 0; i < 3; i++ {
+		tasks = append(tasks, newTask(t, &common.Message{ID: fmt.Sprintf("slow-%d", i), MessageType: "queue", PayloadType: common.PayloadTypeNone}))
+	}
+
+	// the first task is started before the deadline, the others once it has passed
+	res, err := processBatch(context.Background(), tasks, time.Now().Add(50*time.Millisecond))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res).To(Equal(batchResult{received: 3, completed: 1, skipped: 2}))
+
+	g.Expect(tasks[0].(*fakeTask).Completed()).To(Equal(1))
+	g.Expect(tasks[1].(*fakeTask).Completed()).To(BeZero())
+	g.Expect(tasks[2].(*fakeTask).Completed()).To(BeZero())
+}
+
+func TestConsumeQueueStopsAtContextDeadline(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	setupWorker(t)
+	drain = &drainPolicy{batchSize: 1, budget: time.Hour}
+
+	for i := 0; i < 3; i++ {
+		_, err := queue.Send(context.Background(), []*queues.Task{{ID: fmt.Sprintf("task-%d", i), PayloadType: common.PayloadTypeNone, Payload: map[string]interface{}{}}})
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	// already within the headroom, so nothing is received
+	ctx, cancel := context.WithTimeout(context.Background(), drainHeadroom/2)
+	defer cancel()
+
+	res, err := consumeQueue(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res).To(Equal(batchResult{}))
+
+	// the tasks are left on the queue
+	tasks, err := queue.Receive(context.Background(), 10)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tasks).To(HaveLen(3))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// registerHandlers adds the processing for each payload type to the dispatcher
+func registerHandlers(d *dispatcher) {
+	d.Handle(common.PayloadTypeNone, noneHandler)
+	d.Handle(common.PayloadTypePing, pingHandler)
+	d.Handle(common.PayloadTypeStore, storeHandler)
+	d.Handle(common.PayloadTypeFail, failHandler)
+}
+
+func noneHandler(ctx context.Context, d *delivery) error {
+	fmt.Printf("%s message %s: %s\n", d.Source, d.Message.ID, d.Payload)
+	return nil
+}
+
+func pingHandler(ctx context.Context, d *delivery) error {
+	ping := d.Payload.(*common.Ping)
+	fmt.Printf("%s ping %s: %s\n", d.Source, d.Message.ID, ping.Note)
+
+	return nil
+}
+
+func storeHandler(ctx context.Context, d *delivery) error {
+	store := d.Payload.(*common.Store)
+	fmt.Printf("%s store %s: %s\n", d.Source, store.ID, store.Data)
+
+	return nil
+}
+
+func failHandler(ctx context.Context, d *delivery) error {
+	fail := d.Payload.(*common.Fail)
+	return fmt.Errorf("%s fail %s: %s", d.Source, d.Message.ID, fail.Reason)
+}
+
+// defaultHandler receives messages whose payload type has no handler
+func defaultHandler(ctx context.Context, d *delivery) error {
+	fmt.Printf("no handler for %s payload type %q of message %s\n", d.Source, d.Message.PayloadType, d.Message.ID)
+	return nil
+}
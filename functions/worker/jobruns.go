@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/documents"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// lockerFromEnv reads JOB_LOCK_TTL (e.g. "1m"), how long a job's lease lasts without being renewed
+func lockerFromEnv(col documents.CollectionRef) (*common.Locker, error) {
+	ttl := time.Minute
+
+	if v := os.Getenv("JOB_LOCK_TTL"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid JOB_LOCK_TTL %s, must be a duration", v)
+		}
+	}
+
+	l, err := common.NewLocker(col, common.WithLeaseTTL(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JOB_LOCK_TTL: %w", err)
+	}
+
+	return l, nil
+}
+
+// job is the work run by a schedule, returning the counts of the tasks it processed
+type job func(ctx context.Context) (batchResult, error)
+
+func saveJobRun(ctx context.Context, run *common.JobRun) error {
+	runMap := make(map[string]interface{})
+	if err := mapstructure.Decode(run, &runMap); err != nil {
+		return err
+	}
+
+	return jobRuns.Doc(run.ID).Set(ctx, runMap)
+}
+
+// executeJob runs the job holding its lease, so only one run of each job happens at a time, recording the run
+// in the job-runs collection when it starts and again when it finishes. A run is recorded as skipped when
+// another run holds the lease. Failing to record the run is only logged.
+func executeJob(ctx context.Context, run *common.JobRun, j job) error {
+	run.Start = time.Now().UnixMicro()
+
+	err := locker.WithLease(ctx, run.Job, func(ctx context.Context) error {
+		run.Status = common.JobRunning
+		if err := saveJobRun(ctx, run); err != nil {
+			fmt.Printf("error recording start of %s run: %v\n", run.Schedule, err)
+		}
+
+		res, err := j(ctx)
+		run.Received, run.Completed, run.Failed = res.received, res.completed, res.failed
+
+		return err
+	})
+
+	var held *common.ErrLeaseHeld
+	if errors.As(err, &held) {
+		fmt.Printf("skipping %s run: %v\n", run.Schedule, err)
+		run.Skip(time.Now(), err)
+		err = nil
+	} else {
+		run.Finish(time.Now(), err)
+	}
+
+	if saveErr := saveJobRun(ctx, run); saveErr != nil {
+		fmt.Printf("error recording end of %s run: %v\n", run.Schedule, saveErr)
+	}
+
+	return err
+}
+
+// runJob returns a schedule handler running the job
+func runJob(schedule, name string, j job) faas.EventMiddleware {
+	return func(ec *faas.EventContext, next faas.EventHandler) (*faas.EventContext, error) {
+		run := &common.JobRun{
+			ID:       uuid.New().String(),
+			Schedule: schedule,
+			Job:      name,
+			Trigger:  common.TriggerSchedule,
+		}
+
+		if err := executeJob(ec.Request.Context(), run, j); err != nil {
+			fmt.Println(err)
+			return nil, err
+		}
+
+		return next(ec)
+	}
+}
+
+// pruneJobRuns deletes the runs which started before the cutoff
+func pruneJobRuns(ctx context.Context, cutoff time.Time) (int, error) {
+	results, err := jobRuns.Query().Where(documents.Condition("Start").Lt(documents.NumberValue(int(cutoff.UnixMicro())))).Fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+
+	for _, doc := range results.Documents {
+		if err := doc.Ref().Delete(ctx); err != nil {
+			fmt.Printf("error pruning job run %s: %v\n", doc.Ref().Id(), err)
+			continue
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
@@ -1,34 +1,83 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"strings"
 
-	"github.com/mitchellh/mapstructure"
 	"github.com/nitrictech/go-sdk/api/documents"
 	"github.com/nitrictech/go-sdk/api/queues"
-	"github.com/nitrictech/go-sdk/faas"
 	"github.com/nitrictech/go-sdk/resources"
+
 	"github.com/nitrictech/test-app/common"
-	"google.golang.org/grpc/status"
 )
 
 // 4
 var (
-	history documents.CollectionRef
-	queue   queues.Queue
-	topic   resources.Topic
+	history  documents.CollectionRef
+	staged   documents.CollectionRef
+	attempts documents.CollectionRef
+	dlq      documents.CollectionRef
+	dedup    *dedupStore
+	jobRuns  documents.CollectionRef
+	locker   *common.Locker
+	queue    queues.Queue
+	topic    resources.Topic
+	router   *dispatcher
+	pool     *workerPool
+	drain    *drainPolicy
+
+	taskRetry common.RetryPolicy
 )
 
 func main() {
 	var err error
-	history, err = resources.NewCollection("history", resources.CollectionWriting)
+	history, err = resources.NewCollection("history", resources.CollectionWriting, resources.CollectionReading, resources.CollectionDeleting)
+	if err != nil {
+		panic(err)
+	}
+
+	queue, err = resources.NewQueue("work", resources.QueueReceving, resources.QueueSending)
+	if err != nil {
+		panic(err)
+	}
+
+	staged, err = resources.NewCollection("staged", resources.CollectionReading, resources.CollectionDeleting)
+	if err != nil {
+		panic(err)
+	}
+
+	attempts, err = resources.NewCollection("attempts", resources.CollectionEverything...)
+	if err != nil {
+		panic(err)
+	}
+
+	dlq, err = resources.NewCollection("work-dlq", resources.CollectionWriting)
+	if err != nil {
+		panic(err)
+	}
+
+	processed, err := resources.NewCollection("processed", resources.CollectionEverything...)
 	if err != nil {
 		panic(err)
 	}
 
-	queue, err = resources.NewQueue("work", resources.QueueReceving)
+	dedup, err = dedupStoreFromEnv(processed)
+	if err != nil {
+		panic(err)
+	}
+
+	jobRuns, err = resources.NewCollection("job-runs", resources.CollectionEverything...)
+	if err != nil {
+		panic(err)
+	}
+
+	locks, err := resources.NewCollection("locks", resources.CollectionEverything...)
+	if err != nil {
+		panic(err)
+	}
+
+	locker, err = lockerFromEnv(locks)
 	if err != nil {
 		panic(err)
 	}
@@ -38,60 +87,65 @@ func main() {
 		panic(err)
 	}
 
-	topic.Subscribe(func(ec *faas.EventContext, next faas.EventHandler) (*faas.EventContext, error) {
-		fmt.Printf("received on %s mesg %s", ec.Request.Topic(), string(ec.Request.Data()))
-		common.RecordFact(ec.Request.Context(), history, ec.Request.Topic(), "received event", string(ec.Request.Data()))
-		return next(ec)
-	})
+	pool, err = workerPoolFromEnv()
+	if err != nil {
+		panic(err)
+	}
 
-	err = resources.NewSchedule("five-min-schedule", "5 minutes", func(ec *faas.EventContext, next faas.EventHandler) (*faas.EventContext, error) {
-		fmt.Println("scheduled job")
+	drain, err = drainPolicyFromEnv()
+	if err != nil {
+		panic(err)
+	}
 
-		tasks, err := queue.Receive(ec.Request.Context(), 10)
-		if err != nil {
-			fmt.Println(err)
-			return nil, err
-		}
+	taskRetry, err = taskRetryPolicyFromEnv()
+	if err != nil {
+		panic(err)
+	}
 
-		fmt.Printf("got (%d) tasks\n", len(tasks))
+	router = newDispatcher(defaultHandler)
+	registerHandlers(router)
 
-		for _, task := range tasks {
-			msg := &common.Message{}
-			err := mapstructure.Decode(task.Task().Payload, msg)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
+	topic.Subscribe(eventHandler)
 
-			b, err := json.Marshal(msg)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
+	retention, err := retentionPolicyFromEnv()
+	if err != nil {
+		panic(err)
+	}
 
-			if err = task.Complete(ec.Request.Context()); err != nil {
-				fmt.Println(err)
+	schedules, err := common.LoadSchedules()
+	if err != nil {
+		panic(err)
+	}
+
+	jobs := map[string]job{
+		common.JobConsumeQueue:    consumeQueue,
+		common.JobReleaseStaged:   releaseStagedJob,
+		common.JobPruneHistory:    retention.job,
+		common.JobExpireProcessed: dedup.expireJob,
+	}
+
+	err = registerSchedules(schedules, jobs)
+	if err != nil {
+		panic(err)
+	}
 
-				if s, ok := status.FromError(err); ok {
-					for _, item := range s.Details() {
-						fmt.Printf("%v", item)
-					}
+	published, err := resources.NewCollection("schedules", resources.CollectionWriting)
+	if err != nil {
+		panic(err)
+	}
 
-					fmt.Printf("%v\n", s)
-				} else {
-					fmt.Printf("err type %T\n", err)
-				}
-			} else {
-				common.RecordFact(ec.Request.Context(), history, queue.Name(), "task complete", string(b))
-			}
-		}
+	// the store describes the schedules the worker publishes, a failure only leaves it describing older ones
+	if err := common.PublishSchedules(context.Background(), published, schedules); err != nil {
+		fmt.Println("error publishing schedules:", err)
+	}
 
-		return next(ec)
-	})
+	trigger, err := resources.NewTopic("job-trigger")
 	if err != nil {
 		panic(err)
 	}
 
+	trigger.Subscribe(triggerHandler(schedules, jobs))
+
 	err = resources.Run()
 	if err != nil && !strings.Contains(err.Error(), "EOF") {
 		panic(err)
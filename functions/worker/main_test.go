@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/queues"
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+	"github.com/nitrictech/test-app/internal/docstest"
+)
+
+// fakeTask is a task received from a fakeQueue, counting how often it is completed
+type fakeTask struct {
+	queue string
+	task  *queues.Task
+
+	mu        sync.Mutex
+	completed int
+}
+
+func (t *fakeTask) Queue() string {
+	return t.queue
+}
+
+func (t *fakeTask) Task() *queues.Task {
+	return t.task
+}
+
+func (t *fakeTask) Complete(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.completed++
+
+	return nil
+}
+
+func (t *fakeTask) Completed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.completed
+}
+
+// fakeQueue holds the tasks sent to it until they are received
+type fakeQueue struct {
+	name string
+
+	mu    sync.Mutex
+	tasks []*queues.Task
+}
+
+func (q *fakeQueue) Name() string {
+	return q.name
+}
+
+func (q *fakeQueue) Send(ctx context.Context, tasks []*queues.Task) ([]*queues.FailedTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.tasks = append(q.tasks, tasks...)
+
+	return nil, nil
+}
+
+func (q *fakeQueue) Receive(ctx context.Context, depth int) ([]queues.ReceivedTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	received := []queues.ReceivedTask{}
+	for len(q.tasks) > 0 && len(received) < depth {
+		received = append(received, &fakeTask{queue: q.name, task: q.tasks[0]})
+		q.tasks = q.tasks[1:]
+	}
+
+	return received, nil
+}
+
+// fakeEventRequest is an event delivered on a topic
+type fakeEventRequest struct {
+	topic string
+	data  []byte
+}
+
+func (r *fakeEventRequest) Data() []byte {
+	return r.data
+}
+
+func (r *fakeEventRequest) MimeType() string {
+	return "application/json"
+}
+
+func (r *fakeEventRequest) Context() context.Context {
+	return context.Background()
+}
+
+func (r *fakeEventRequest) Topic() string {
+	return r.topic
+}
+
+// newEvent returns the context of an event on the topic carrying v as json
+func newEvent(t *testing.T, topic string, v interface{}) *faas.EventContext {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &faas.EventContext{
+		Request:  &fakeEventRequest{topic: topic, data: b},
+		Response: &faas.EventResponse{Success: true},
+		Extras:   map[string]interface{}{},
+	}
+}
+
+// handled ends a chain of event handlers
+func handled(ec *faas.EventContext) (*faas.EventContext, error) {
+	return ec, nil
+}
+
+// setupWorker points the worker's resources at an in-memory documents service and a fake queue
+func setupWorker(t *testing.T) *docstest.Server {
+	t.Helper()
+
+	srv := docstest.Start(t)
+
+	history = srv.Collection("history")
+	staged = srv.Collection("staged")
+	attempts = srv.Collection("attempts")
+	dlq = srv.Collection("work-dlq")
+	jobRuns = srv.Collection("job-runs")
+	dedup = &dedupStore{col: srv.Collection("processed"), ttl: time.Hour}
+	queue = &fakeQueue{name: "work-" + t.Name()}
+	pool = &workerPool{concurrency: 4, timeout: time.Second}
+	drain = &drainPolicy{batchSize: 10}
+	taskRetry = common.NoRetry
+
+	var err error
+	if locker, err = common.NewLocker(srv.Collection("locks"), common.WithSettleDelay(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	router = newDispatcher(defaultHandler)
+	registerHandlers(router)
+
+	return srv
+}
+
+// newTask returns a task received from the queue carrying the message
+func newTask(t *testing.T, msg *common.Message) *fakeTask {
+	t.Helper()
+
+	payload := map[string]interface{}{}
+	if err := mapstructure.Decode(msg, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	return &fakeTask{
+		queue: queue.Name(),
+		task:  &queues.Task{ID: msg.ID, PayloadType: msg.PayloadType, Payload: payload},
+	}
+}
+
+// factsFrom returns the facts recorded from the source with the action
+func factsFrom(t *testing.T, source, action string) []common.Fact {
+	t.Helper()
+
+	facts, err := common.ReadFacts(context.Background(), history.Query())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched := []common.Fact{}
+	for _, f := range facts {
+		if f.Source == source && f.Action == action {
+			matched = append(matched, f)
+		}
+	}
+
+	return matched
+}
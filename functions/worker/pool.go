@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// workerPool runs task processing in parallel, giving each task its own timeout
+type workerPool struct {
+	concurrency int
+	timeout     time.Duration
+}
+
+// workerPoolFromEnv reads WORKER_CONCURRENCY and TASK_TIMEOUT (e.g. "30s")
+func workerPoolFromEnv() (*workerPool, error) {
+	p := &workerPool{
+		concurrency: 4,
+		timeout:     30 * time.Second,
+	}
+
+	var err error
+
+	if v := os.Getenv("WORKER_CONCURRENCY"); v != "" {
+		p.concurrency, err = strconv.Atoi(v)
+		if err != nil || p.concurrency < 1 {
+			return nil, fmt.Errorf("invalid WORKER_CONCURRENCY %s, must be a positive integer", v)
+		}
+	}
+
+	if v := os.Getenv("TASK_TIMEOUT"); v != "" {
+		p.timeout, err = time.ParseDuration(v)
+		if err != nil || p.timeout <= 0 {
+			return nil, fmt.Errorf("invalid TASK_TIMEOUT %s, must be a positive duration", v)
+		}
+	}
+
+	return p, nil
+}
+
+// taskTimeoutError is the error of a task which failed after running out of time
+type taskTimeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *taskTimeoutError) Error() string {
+	return fmt.Sprintf("task timed out after %s: %v", e.timeout, e.err)
+}
+
+func (e *taskTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// run calls fn for each index in [0, n), at most concurrency at a time, returning the error from each.
+// Each call's context is cancelled after the timeout and run waits for the call to return, so fn must give up
+// once its context is done. A call which fails after its timeout returns a *taskTimeoutError.
+func (p *workerPool) run(ctx context.Context, n int, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, p.concurrency)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			tctx, cancel := context.WithTimeout(ctx, p.timeout)
+			defer cancel()
+
+			err := fn(tctx, i)
+			if err != nil && errors.Is(tctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+				err = &taskTimeoutError{timeout: p.timeout, err: err}
+			}
+
+			errs[i] = err
+		}(i)
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
+// taskErrors aggregates the errors from processing a batch of tasks
+type taskErrors struct {
+	errs []error
+}
+
+func (e *taskErrors) Error() string {
+	msgs := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("(%d) tasks failed: %s", len(e.errs), strings.Join(msgs, "; "))
+}
+
+// combineErrors returns a *taskErrors holding the non nil errors, or nil if there are none
+func combineErrors(errs ...[]error) error {
+	te := &taskErrors{}
+
+	for _, es := range errs {
+		for _, err := range es {
+			if err != nil {
+				te.errs = append(te.errs, err)
+			}
+		}
+	}
+
+	if len(te.errs) == 0 {
+		return nil
+	}
+
+	return te
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/queues"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func TestPoolRunWaitsForHangingTask(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := &workerPool{concurrency: 2, timeout: 50 * time.Millisecond}
+
+	var returned int32
+
+	errs := p.run(context.Background(), 2, func(ctx context.Context, i int) error {
+		if i == 1 {
+			return nil
+		}
+
+		<-ctx.Done()
+		// give up slowly, run must still wait for it
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&returned, 1)
+
+		return ctx.Err()
+	})
+
+	g.Expect(atomic.LoadInt32(&returned)).To(BeEquivalentTo(1))
+	g.Expect(errs[1]).ToNot(HaveOccurred())
+
+	var timeout *taskTimeoutError
+	g.Expect(errors.As(errs[0], &timeout)).To(BeTrue())
+	g.Expect(errs[0]).To(MatchError(context.DeadlineExceeded))
+}
+
+func TestPoolRunCancelledIsNotTimeout(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := &workerPool{concurrency: 1, timeout: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	errs := p.run(ctx, 1, func(ctx context.Context, i int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	var timeout *taskTimeoutError
+	g.Expect(errors.As(errs[0], &timeout)).To(BeFalse())
+	g.Expect(errs[0]).To(MatchError(context.Canceled))
+}
+
+func TestProcessBatchHangingTask(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	srv := setupWorker(t)
+	pool.timeout = 100 * time.Millisecond
+
+	router.Handle(common.PayloadTypeNone, func(ctx context.Context, d *delivery) error {
+		if d.Message.Payload == "hang" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		return nil
+	})
+
+	hung := newTask(t, &common.Message{ID: "hung", MessageType: "queue", PayloadType: common.PayloadTypeNone, Payload: "hang"})
+	ok := newTask(t, &common.Message{ID: "ok", MessageType: "queue", PayloadType: common.PayloadTypeNone, Payload: "ok"})
+
+	res, err := processBatch(context.Background(), []queues.ReceivedTask{hung, ok}, time.Time{})
+	g.Expect(err).To(MatchError(ContainSubstring("task timed out")))
+	g.Expect(res).To(Equal(batchResult{received: 2, completed: 1, failed: 1}))
+
+	g.Expect(hung.Completed()).To(Equal(0))
+	g.Expect(ok.Completed()).To(Equal(1))
+
+	// the timeout counts as a failed delivery
+	g.Expect(srv.Docs("attempts")).To(HaveKey("hung"))
+	g.Expect(srv.Docs("attempts")["hung"]["Attempts"]).To(BeEquivalentTo(1))
+
+	g.Expect(factsFrom(t, queue.Name(), "task complete")).To(HaveLen(1))
+
+	facts, err := common.ReadFacts(context.Background(), history.Query())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(common.VerifyChain(facts).OK).To(BeTrue())
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+const retentionSource = "history-retention"
+
+// retentionPolicy limits how long, and how many, facts are kept in the history collection.
+// A zero value for either limit disables it.
+type retentionPolicy struct {
+	MaxAge       time.Duration
+	MaxPerSource int
+}
+
+// retentionPolicyFromEnv reads HISTORY_MAX_AGE (e.g. "168h") and HISTORY_MAX_PER_SOURCE
+func retentionPolicyFromEnv() (*retentionPolicy, error) {
+	p := &retentionPolicy{
+		MaxAge:       7 * 24 * time.Hour,
+		MaxPerSource: 1000,
+	}
+
+	var err error
+
+	if v := os.Getenv("HISTORY_MAX_AGE"); v != "" {
+		p.MaxAge, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HISTORY_MAX_AGE %s; %w", v, err)
+		}
+	}
+
+	if v := os.Getenv("HISTORY_MAX_PER_SOURCE"); v != "" {
+		p.MaxPerSource, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HISTORY_MAX_PER_SOURCE %s; %w", v, err)
+		}
+	}
+
+	if p.MaxAge < 0 || p.MaxPerSource < 0 {
+		return nil, fmt.Errorf("retention limits cannot be negative")
+	}
+
+	return p, nil
+}
+
+type retentionSummary struct {
+	MaxAge       string         `json:"maxAge"`
+	MaxPerSource int            `json:"maxPerSource"`
+	Pruned       map[string]int `json:"pruned"`
+	Total        int            `json:"total"`
+	JobRuns      int            `json:"jobRuns"`
+}
+
+// prune deletes facts which are older than MaxAge, or beyond the newest MaxPerSource for their source
+func (p *retentionPolicy) prune(ctx context.Context) (*retentionSummary, error) {
+	facts, err := common.ReadFacts(ctx, history.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := map[string][]common.Fact{}
+	for _, f := range facts {
+		bySource[f.Source] = append(bySource[f.Source], f)
+	}
+
+	summary := &retentionSummary{
+		MaxAge:       p.MaxAge.String(),
+		MaxPerSource: p.MaxPerSource,
+		Pruned:       map[string]int{},
+	}
+	cutoff := time.Now().Add(-p.MaxAge)
+
+	for source, facts := range bySource {
+		common.SortFacts(facts)
+
+		for i, f := range facts {
+			// facts are sorted oldest first, so keep the last MaxPerSource
+			expired := p.MaxAge > 0 && f.Time().Before(cutoff)
+			excess := p.MaxPerSource > 0 && i < len(facts)-p.MaxPerSource
+
+			if !expired && !excess {
+				continue
+			}
+
+			if err := history.Doc(f.ID).Delete(ctx); err != nil {
+				fmt.Printf("error pruning fact %s: %v\n", f.ID, err)
+				continue
+			}
+
+			summary.Pruned[source]++
+			summary.Total++
+		}
+	}
+
+	return summary, nil
+}
+
+// job prunes the history, and job runs older than MaxAge, counting the pruned facts as completed
+func (p *retentionPolicy) job(ctx context.Context) (batchResult, error) {
+	summary, err := p.prune(ctx)
+	if err != nil {
+		return batchResult{}, err
+	}
+
+	if p.MaxAge > 0 {
+		summary.JobRuns, err = pruneJobRuns(ctx, time.Now().Add(-p.MaxAge))
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return batchResult{}, err
+	}
+
+	fmt.Printf("pruned (%d) facts and (%d) job runs\n", summary.Total, summary.JobRuns)
+	if err := common.RecordFact(ctx, history, retentionSource, "pruned", string(b)); err != nil {
+		fmt.Println(err)
+	}
+
+	return batchResult{received: summary.Total, completed: summary.Total}, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nitrictech/go-sdk/api/errors/codes"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+const (
+	actionRetry          = "retry"
+	actionRetrySucceeded = "retry succeeded"
+	actionRetryExhausted = "retry exhausted"
+)
+
+// stages of processing a task which are retried
+const (
+	stageHandle   = "handle"
+	stageComplete = "complete"
+)
+
+// taskRetryPolicyFromEnv reads TASK_RETRY_ATTEMPTS, TASK_RETRY_BACKOFF (e.g. "500ms") and TASK_RETRY_MAX_BACKOFF.
+// Only errors which are likely to be transient are retried.
+func taskRetryPolicyFromEnv() (common.RetryPolicy, error) {
+	p := common.RetryPolicy{
+		Attempts:   3,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+		Jitter:     0.2,
+		RetryableCodes: []codes.Code{
+			codes.Unavailable,
+			codes.DeadlineExceeded,
+			codes.ResourceExhausted,
+			codes.Aborted,
+			codes.Internal,
+		},
+	}
+
+	var err error
+
+	if v := os.Getenv("TASK_RETRY_ATTEMPTS"); v != "" {
+		p.Attempts, err = strconv.Atoi(v)
+		if err != nil || p.Attempts < 1 {
+			return p, fmt.Errorf("invalid TASK_RETRY_ATTEMPTS %s, must be a positive integer", v)
+		}
+	}
+
+	if v := os.Getenv("TASK_RETRY_BACKOFF"); v != "" {
+		p.Backoff, err = time.ParseDuration(v)
+		if err != nil || p.Backoff < 0 {
+			return p, fmt.Errorf("invalid TASK_RETRY_BACKOFF %s, must be a non negative duration", v)
+		}
+	}
+
+	if v := os.Getenv("TASK_RETRY_MAX_BACKOFF"); v != "" {
+		p.MaxBackoff, err = time.ParseDuration(v)
+		if err != nil || p.MaxBackoff < 0 {
+			return p, fmt.Errorf("invalid TASK_RETRY_MAX_BACKOFF %s, must be a non negative duration", v)
+		}
+	}
+
+	return p, nil
+}
+
+// retryFact is the data recorded with retry facts
+type retryFact struct {
+	ID      string `json:"id"`
+	Stage   string `json:"stage"`
+	Attempt int    `json:"attempt"`
+	Wait    string `json:"wait,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func recordRetry(ctx context.Context, action string, f *retryFact) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := common.RecordFact(ctx, history, queue.Name(), action, string(b)); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// retryTask calls fn with the task retry policy, recording each retry and, when there were any, the final outcome
+func retryTask(ctx context.Context, id, stage string, fn func() error) error {
+	tries := 1
+
+	err := taskRetry.DoNotify(ctx, fn, func(attempt int, err error, wait time.Duration) {
+		tries = attempt
+		recordRetry(ctx, actionRetry, &retryFact{ID: id, Stage: stage, Attempt: attempt, Wait: wait.String(), Error: err.Error()})
+	})
+
+	if tries > 1 {
+		action := actionRetrySucceeded
+		f := &retryFact{ID: id, Stage: stage, Attempt: tries}
+
+		if err != nil {
+			action = actionRetryExhausted
+			f.Error = err.Error()
+		}
+
+		recordRetry(ctx, action, f)
+	}
+
+	return err
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTaskRetryPolicyFromEnv(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p, err := taskRetryPolicyFromEnv()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.MaxBackoff).To(Equal(5 * time.Second))
+
+	t.Setenv("TASK_RETRY_MAX_BACKOFF", "0")
+	p, err = taskRetryPolicyFromEnv()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.MaxBackoff).To(BeZero())
+
+	t.Setenv("TASK_RETRY_MAX_BACKOFF", "30s")
+	p, err = taskRetryPolicyFromEnv()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.MaxBackoff).To(Equal(30 * time.Second))
+
+	t.Setenv("TASK_RETRY_MAX_BACKOFF", "soon")
+	_, err = taskRetryPolicyFromEnv()
+	g.Expect(err).To(MatchError(ContainSubstring("invalid TASK_RETRY_MAX_BACKOFF soon")))
+}
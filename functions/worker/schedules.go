@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/documents"
+	"github.com/nitrictech/go-sdk/faas"
+	"github.com/nitrictech/go-sdk/resources"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// cronTickSchedule checks every minute for cron schedules which are due, as nitric schedules only take rates
+const cronTickSchedule = "cron-tick"
+
+// cronSchedule is a schedule with a parsed cron expression
+type cronSchedule struct {
+	common.Schedule
+	cron *common.Cron
+	run  faas.EventMiddleware
+}
+
+// cronState remembers when a cron schedule last ran (unix microseconds), so a late or
+// repeated tick neither skips nor repeats a run
+type cronState struct {
+	Name    string
+	LastRun int64
+}
+
+type cronRunner struct {
+	col       documents.CollectionRef
+	schedules []*cronSchedule
+}
+
+// registerSchedules registers a nitric schedule for each configured rate schedule, and a cron tick
+// running the jobs of the cron schedules when they are due. Every run of a job is recorded.
+func registerSchedules(schedules []common.Schedule, jobs map[string]job) error {
+	for _, s := range schedules {
+		if _, ok := jobs[s.Job]; !ok {
+			return fmt.Errorf("schedule %s has unknown job %s", s.Name, s.Job)
+		}
+
+		if s.Name == cronTickSchedule {
+			return fmt.Errorf("schedule name %s is reserved", cronTickSchedule)
+		}
+	}
+
+	runner := &cronRunner{}
+
+	for _, s := range schedules {
+		if s.Cron != "" {
+			c, err := s.ParseCron()
+			if err != nil {
+				return err
+			}
+
+			runner.schedules = append(runner.schedules, &cronSchedule{Schedule: s, cron: c, run: runJob(s.Name, s.Job, jobs[s.Job])})
+
+			continue
+		}
+
+		if err := resources.NewSchedule(s.Name, s.Rate, runJob(s.Name, s.Job, jobs[s.Job])); err != nil {
+			return err
+		}
+	}
+
+	if len(runner.schedules) == 0 {
+		return nil
+	}
+
+	var err error
+
+	runner.col, err = resources.NewCollection("cron-state", resources.CollectionEverything...)
+	if err != nil {
+		return err
+	}
+
+	return resources.NewSchedule(cronTickSchedule, "1 minutes", runner.handler)
+}
+
+// lastRun returns when the schedule last ran, or a minute ago if it never has
+func (r *cronRunner) lastRun(ctx context.Context, name string, now time.Time) time.Time {
+	doc, err := r.col.Doc(name).Get(ctx)
+	if err != nil {
+		return now.Add(-time.Minute)
+	}
+
+	cs := &cronState{}
+	if err := mapstructure.Decode(doc.Content(), cs); err != nil {
+		fmt.Println(err)
+		return now.Add(-time.Minute)
+	}
+
+	return time.UnixMicro(cs.LastRun)
+}
+
+func (r *cronRunner) setLastRun(ctx context.Context, name string, t time.Time) error {
+	csMap := make(map[string]interface{})
+	if err := mapstructure.Decode(&cronState{Name: name, LastRun: t.UnixMicro()}, &csMap); err != nil {
+		return err
+	}
+
+	return r.col.Doc(name).Set(ctx, csMap)
+}
+
+// handler runs the job of each cron schedule with a run due since it last ran. Runs missed while
+// the worker wasn't ticking are caught up with a single run.
+func (r *cronRunner) handler(ec *faas.EventContext, next faas.EventHandler) (*faas.EventContext, error) {
+	ctx := ec.Request.Context()
+	now := time.Now()
+
+	for _, s := range r.schedules {
+		due := s.cron.Next(r.lastRun(ctx, s.Name, now))
+		if due.IsZero() || due.After(now) {
+			continue
+		}
+
+		if err := r.setLastRun(ctx, s.Name, now); err != nil {
+			// skip the run rather than risk repeating it on the next tick
+			fmt.Printf("error recording run of schedule %s: %v\n", s.Name, err)
+			continue
+		}
+
+		fmt.Printf("running cron schedule %s due at %s\n", s.Name, due.Format(time.RFC3339))
+
+		_, err := s.run(ec, func(ec *faas.EventContext) (*faas.EventContext, error) {
+			return ec, nil
+		})
+		if err != nil {
+			fmt.Printf("error running schedule %s: %v\n", s.Name, err)
+		}
+	}
+
+	return next(ec)
+}
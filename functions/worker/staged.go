@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nitrictech/go-sdk/api/documents"
+	"github.com/nitrictech/go-sdk/api/queues"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// releaseStaged sends every staged task which is due to the queue, removing it from the staged collection
+func releaseStaged(ctx context.Context) (int, error) {
+	now := time.Now().UnixMicro()
+
+	results, err := staged.Query().Where(documents.Condition("Due").Le(documents.NumberValue(int(now)))).Fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+
+	for _, doc := range results.Documents {
+		st := &common.StagedTask{}
+		if err := mapstructure.Decode(doc.Content(), st); err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		failed, err := queue.Send(ctx, []*queues.Task{
+			{
+				ID:          st.ID,
+				PayloadType: st.PayloadType,
+				Payload:     st.Payload,
+			},
+		})
+		if err == nil && len(failed) > 0 {
+			err = fmt.Errorf("queue rejected task: %s", failed[0].Reason)
+		}
+
+		if err != nil {
+			// leave it staged to try again on the next sweep
+			fmt.Printf("error releasing staged task %s: %v\n", st.ID, err)
+			continue
+		}
+
+		if err := doc.Ref().Delete(ctx); err != nil {
+			fmt.Printf("error removing staged task %s: %v\n", st.ID, err)
+		}
+
+		released++
+	}
+
+	return released, nil
+}
+
+// releaseStagedJob counts the released tasks as completed
+func releaseStagedJob(ctx context.Context) (batchResult, error) {
+	released, err := releaseStaged(ctx)
+	if err != nil {
+		return batchResult{}, err
+	}
+
+	fmt.Printf("released (%d) staged tasks\n", released)
+
+	return batchResult{received: released, completed: released}, nil
+}
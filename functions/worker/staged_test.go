@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// stage holds the message in the staged collection until due
+func stage(t *testing.T, msg *common.Message, due time.Time) {
+	t.Helper()
+
+	payload := map[string]interface{}{}
+	if err := mapstructure.Decode(msg, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	st := map[string]interface{}{}
+	if err := mapstructure.Decode(&common.StagedTask{ID: msg.ID, Due: due.UnixMicro(), PayloadType: msg.PayloadType, Payload: payload}, &st); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := staged.Doc(msg.ID).Set(context.Background(), st); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStagedTaskDeliveredOnceDue(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ctx := context.Background()
+
+	srv := setupWorker(t)
+
+	due := &common.Message{ID: "due", MessageType: "queue", PayloadType: common.PayloadTypeNone, Payload: "due"}
+	later := &common.Message{ID: "later", MessageType: "queue", PayloadType: common.PayloadTypeNone, Payload: "later"}
+
+	stage(t, due, time.Now().Add(-time.Second))
+	stage(t, later, time.Now().Add(time.Hour))
+
+	result, err := releaseStagedJob(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.completed).To(Equal(1))
+
+	g.Expect(srv.Docs("staged")).ToNot(HaveKey("due"))
+	g.Expect(srv.Docs("staged")).To(HaveKey("later"))
+
+	// the released task is consumed like any other
+	result, err = consumeQueue(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.received).To(Equal(1))
+	g.Expect(result.completed).To(Equal(1))
+
+	g.Expect(factsFrom(t, queue.Name(), "task complete")).To(HaveLen(1))
+
+	// nothing more is due
+	result, err = releaseStagedJob(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.completed).To(BeZero())
+}
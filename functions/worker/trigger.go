@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nitrictech/go-sdk/faas"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+// triggerHandler runs the jobs published to the job-trigger topic by POST /jobs/:name/run, resolving the trigger
+// against the worker's schedules. A trigger of an unknown name is recorded as a failed run of that name.
+// Triggers are acknowledged even when the job fails, the failure is recorded in its run rather than retried.
+func triggerHandler(schedules []common.Schedule, jobs map[string]job) faas.EventMiddleware {
+	return func(ec *faas.EventContext, next faas.EventHandler) (*faas.EventContext, error) {
+		ctx := ec.Request.Context()
+
+		trigger := &common.JobTrigger{}
+		if err := json.Unmarshal(ec.Request.Data(), trigger); err != nil {
+			fmt.Println(err)
+			return next(ec)
+		}
+
+		run := &common.JobRun{
+			ID:       trigger.ID,
+			Schedule: trigger.Name,
+			Trigger:  common.TriggerManual,
+			Start:    time.Now().UnixMicro(),
+		}
+
+		schedule, name, err := trigger.Resolve(schedules)
+		if err == nil {
+			run.Schedule, run.Job = schedule, name
+		}
+
+		j, ok := jobs[name]
+		if err == nil && !ok {
+			err = fmt.Errorf("job %s isn't run by this worker", name)
+		}
+
+		if err != nil {
+			fmt.Printf("ignoring trigger %s: %v\n", trigger.ID, err)
+
+			run.Finish(time.Now(), err)
+			if err := saveJobRun(ctx, run); err != nil {
+				fmt.Printf("error recording run %s: %v\n", run.ID, err)
+			}
+
+			return next(ec)
+		}
+
+		fmt.Printf("running %s for schedule %s on trigger %s\n", run.Job, run.Schedule, trigger.ID)
+
+		if err := executeJob(ctx, run, j); err != nil {
+			fmt.Println(err)
+		}
+
+		return next(ec)
+	}
+}
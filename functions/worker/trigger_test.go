@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/nitrictech/test-app/common"
+)
+
+func TestTriggerResolvesWorkerSchedules(t *testing.T) {
+	srv := setupWorker(t)
+
+	schedules := []common.Schedule{{Name: "worker-only", Rate: "5 minutes", Job: common.JobConsumeQueue}}
+	jobs := map[string]job{
+		common.JobConsumeQueue:  consumeQueue,
+		common.JobReleaseStaged: releaseStagedJob,
+	}
+
+	tests := []struct {
+		name     string
+		schedule string
+		job      string
+		status   string
+	}{
+		{name: "worker-only", schedule: "worker-only", job: common.JobConsumeQueue, status: common.JobSucceeded},
+		{name: common.JobReleaseStaged, schedule: common.ManualSchedule, job: common.JobReleaseStaged, status: common.JobSucceeded},
+		{name: "no-such-job", schedule: "no-such-job", status: common.JobFailed},
+		{name: common.JobPruneHistory, schedule: common.ManualSchedule, job: common.JobPruneHistory, status: common.JobFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+
+			trigger := &common.JobTrigger{ID: "run-" + tt.name, Name: tt.name}
+
+			ec, err := triggerHandler(schedules, jobs)(newEvent(t, "job-trigger", trigger), handled)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ec.Response.Success).To(BeTrue())
+
+			run := srv.Docs("job-runs")[trigger.ID]
+			g.Expect(run).ToNot(BeNil())
+			g.Expect(run["Schedule"]).To(Equal(tt.schedule))
+			g.Expect(run["Job"]).To(Equal(tt.job))
+			g.Expect(run["Trigger"]).To(Equal(common.TriggerManual))
+			g.Expect(run["Status"]).To(Equal(tt.status))
+		})
+	}
+
+	_, _, err := (&common.JobTrigger{Name: "no-such-job"}).Resolve(schedules)
+	NewGomegaWithT(t).Expect(err).To(MatchError(ContainSubstring("unknown schedule or job no-such-job")))
+}
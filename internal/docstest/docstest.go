@@ -0,0 +1,316 @@
+// Package docstest serves an in-memory nitric documents service, so code using documents
+// collections can be unit tested without a membrane.
+package docstest
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nitrictech/go-sdk/api/documents"
+	v1 "github.com/nitrictech/go-sdk/nitric/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Hook is called before every operation on a document, failing the operation when it returns an error.
+// op is one of "get", "set", "delete" or "query", id is empty for queries.
+type Hook func(op, collection, id string) error
+
+type Server struct {
+	v1.UnimplementedDocumentServiceServer
+
+	mu   sync.Mutex
+	cols map[string]map[string]*structpb.Struct
+	hook Hook
+
+	docs documents.Documents
+}
+
+// Start serves the documents service on a free local port, pointing the nitric sdk at it for the rest of the test
+func Start(t *testing.T) *Server {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{cols: map[string]map[string]*structpb.Struct{}}
+
+	srv := grpc.NewServer()
+	v1.RegisterDocumentServiceServer(srv, s)
+
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+
+	t.Cleanup(srv.Stop)
+
+	host, port, _ := net.SplitHostPort(lis.Addr().String())
+	t.Setenv("NITRIC_SERVICE_HOST", host)
+	t.Setenv("NITRIC_SERVICE_PORT", port)
+
+	s.docs, err = documents.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// Collection returns a reference to a collection held by the server
+func (s *Server) Collection(name string) documents.CollectionRef {
+	return s.docs.Collection(name)
+}
+
+// SetHook replaces the hook called before each operation, nil removes it
+func (s *Server) SetHook(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hook = hook
+}
+
+// Docs returns a copy of every document in the collection, keyed by id
+func (s *Server) Docs(collection string) map[string]map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := map[string]map[string]interface{}{}
+	for id, content := range s.cols[collection] {
+		docs[id] = content.AsMap()
+	}
+
+	return docs
+}
+
+// Put writes a document directly, bypassing the hook
+func (s *Server) Put(collection, id string, content map[string]interface{}) error {
+	st, err := structpb.NewStruct(content)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(collection, id, st)
+
+	return nil
+}
+
+func (s *Server) put(collection, id string, content *structpb.Struct) {
+	if s.cols[collection] == nil {
+		s.cols[collection] = map[string]*structpb.Struct{}
+	}
+
+	s.cols[collection][id] = content
+}
+
+func (s *Server) call(op, collection, id string) error {
+	s.mu.Lock()
+	hook := s.hook
+	s.mu.Unlock()
+
+	if hook == nil {
+		return nil
+	}
+
+	if err := hook(op, collection, id); err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return nil
+}
+
+func (s *Server) Get(ctx context.Context, req *v1.DocumentGetRequest) (*v1.DocumentGetResponse, error) {
+	collection, id := req.Key.Collection.Name, req.Key.Id
+	if err := s.call("get", collection, id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.cols[collection][id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "document %s/%s not found", collection, id)
+	}
+
+	return &v1.DocumentGetResponse{Document: &v1.Document{Key: req.Key, Content: content}}, nil
+}
+
+func (s *Server) Set(ctx context.Context, req *v1.DocumentSetRequest) (*v1.DocumentSetResponse, error) {
+	collection, id := req.Key.Collection.Name, req.Key.Id
+	if err := s.call("set", collection, id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(collection, id, req.Content)
+
+	return &v1.DocumentSetResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *v1.DocumentDeleteRequest) (*v1.DocumentDeleteResponse, error) {
+	collection, id := req.Key.Collection.Name, req.Key.Id
+	if err := s.call("delete", collection, id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cols[collection], id)
+
+	return &v1.DocumentDeleteResponse{}, nil
+}
+
+func (s *Server) Query(ctx context.Context, req *v1.DocumentQueryRequest) (*v1.DocumentQueryResponse, error) {
+	docs, err := s.query(req.Collection, req.Expressions, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.DocumentQueryResponse{Documents: docs}, nil
+}
+
+func (s *Server) QueryStream(req *v1.DocumentQueryStreamRequest, stream v1.DocumentService_QueryStreamServer) error {
+	docs, err := s.query(req.Collection, req.Expressions, req.Limit)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err := stream.Send(&v1.DocumentQueryStreamResponse{Document: doc}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// query returns the matching documents ordered by id, as every page is returned at once
+func (s *Server) query(col *v1.Collection, exprs []*v1.Expression, limit int32) ([]*v1.Document, error) {
+	if err := s.call("query", col.Name, ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.cols[col.Name]))
+	for id := range s.cols[col.Name] {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	docs := []*v1.Document{}
+
+	for _, id := range ids {
+		content := s.cols[col.Name][id]
+		if !matches(content, exprs) {
+			continue
+		}
+
+		docs = append(docs, &v1.Document{Key: &v1.Key{Collection: col, Id: id}, Content: content})
+
+		if limit > 0 && len(docs) >= int(limit) {
+			break
+		}
+	}
+
+	return docs, nil
+}
+
+func matches(content *structpb.Struct, exprs []*v1.Expression) bool {
+	for _, expr := range exprs {
+		field, ok := content.Fields[expr.Operand]
+		if !ok || !compare(field, expr.Operator, expr.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compare(field *structpb.Value, op string, value *v1.ExpressionValue) bool {
+	c, ok := 0, true
+
+	switch v := value.Kind.(type) {
+	case *v1.ExpressionValue_StringValue:
+		s, ok := field.Kind.(*structpb.Value_StringValue)
+		if !ok {
+			return false
+		}
+
+		if op == "startsWith" {
+			return strings.HasPrefix(s.StringValue, v.StringValue)
+		}
+
+		c = strings.Compare(s.StringValue, v.StringValue)
+	case *v1.ExpressionValue_IntValue:
+		c, ok = compareNumber(field, float64(v.IntValue))
+	case *v1.ExpressionValue_DoubleValue:
+		c, ok = compareNumber(field, v.DoubleValue)
+	case *v1.ExpressionValue_BoolValue:
+		b, ok := field.Kind.(*structpb.Value_BoolValue)
+		if !ok || op != "==" && op != "!=" {
+			return false
+		}
+
+		return (b.BoolValue == v.BoolValue) == (op == "==")
+	default:
+		return false
+	}
+
+	if !ok {
+		return false
+	}
+
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+
+	return false
+}
+
+// compareNumber compares a number field with n, reporting false when the field isn't a number
+func compareNumber(field *structpb.Value, n float64) (int, bool) {
+	f, ok := field.Kind.(*structpb.Value_NumberValue)
+
+	switch {
+	case !ok:
+		return 0, false
+	case f.NumberValue < n:
+		return -1, true
+	case f.NumberValue > n:
+		return 1, true
+	}
+
+	return 0, true
+}
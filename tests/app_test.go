@@ -25,6 +25,7 @@ const (
 
 var (
 	localRun     = true
+	jobsToken    = os.Getenv("JOBS_TOKEN")
 	baseUrl      = "http://localhost:4001"
 	topicBaseURL = "http://localhost:4000/topic"
 	storeUrl     = baseUrl + "/store"
@@ -206,7 +207,14 @@ func sendMsg(m *common.Message) error {
 	return nil
 }
 
+// runSchedule triggers the schedule's job through the API when JOBS_TOKEN is set, which works in any environment,
+// otherwise through the local membrane
 func runSchedule(name string) {
+	if jobsToken != "" {
+		_, _, _ = send(http.MethodPost, baseUrl+"/jobs/"+name+"/run", nil, map[string]string{"Authorization": "Bearer " + jobsToken})
+		return
+	}
+
 	if localRun {
 		_, _, _ = send(http.MethodPost, topicBaseURL+"/"+name, "", map[string]string{})
 	}
@@ -404,6 +412,9 @@ func TestAppTopicImmediate(t *testing.T) {
 		WithPolling(pollingInterval).
 		WithTimeout(pollingTimeout).
 		ShouldNot(HaveOccurred())
+
+	err = waitForFactID(testID, "sent")()
+	g.Expect(err).ShouldNot(HaveOccurred())
 }
 
 func TestAppTopicDelay(t *testing.T) {
@@ -461,3 +472,792 @@ func TestAppQueue(t *testing.T) {
 		WithTimeout(10 * time.Minute).
 		ShouldNot(HaveOccurred())
 }
+
+func TestAppHistoryExport(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	testID := uuid.New().String()
+
+	err = sendMsg(&common.Message{
+		MessageType: "topic",
+		ID:          testID,
+		PayloadType: "None",
+		Payload:     testID,
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Eventually(waitForFactID(testID, "received event")).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		ShouldNot(HaveOccurred())
+
+	b, code, err := send(http.MethodGet, historyUrl+"/export?format=ndjson&action=received+event", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+	g.Expect(string(b)).Should(ContainSubstring(testID))
+
+	b, code, err = send(http.MethodGet, historyUrl+"/export?format=csv", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+	g.Expect(strings.HasPrefix(string(b), "id,occured,timestamp,sequence,source,action,data\n")).Should(BeTrue())
+	g.Expect(string(b)).Should(ContainSubstring(testID))
+
+	_, code, err = send(http.MethodGet, historyUrl+"/export?format=xml", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(400))
+}
+
+func TestAppStoreBackup(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteStore()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	err = createStore(&common.Store{ID: "angus", Data: "test34"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	err = createStore(&common.Store{ID: "tim", Data: "test98"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	type result struct {
+		Name    string `json:"name"`
+		Count   int    `json:"count"`
+		Written int    `json:"written"`
+		Skipped int    `json:"skipped"`
+	}
+
+	b, code, err := send(http.MethodPost, storeUrl+"/export", map[string]string{"name": "backups/test.ndjson.gz"}, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	exported := &result{}
+	err = json.Unmarshal(b, exported)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(exported.Count).To(Equal(2))
+
+	err = deleteOne(storeUrl, "tim")
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	b, code, err = send(http.MethodPost, storeUrl+"/import", map[string]string{"name": exported.Name, "policy": "skip"}, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	imported := &result{}
+	err = json.Unmarshal(b, imported)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(imported.Written).To(Equal(1))
+	g.Expect(imported.Skipped).To(Equal(1))
+
+	_, code, err = send(http.MethodPost, storeUrl+"/import", map[string]string{"name": exported.Name, "policy": "fail"}, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(409))
+
+	s, err := listStore()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(len(s)).To(Equal(2))
+
+	// one document conflicts and the other doesn't exist, whichever order they are in nothing is written
+	err = deleteOne(storeUrl, "angus")
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	_, code, err = send(http.MethodPost, storeUrl+"/import", map[string]string{"name": exported.Name, "policy": "fail"}, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(409))
+
+	s, err = listStore()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(s).To(HaveLen(1))
+	g.Expect(s[0].ID).To(Equal("tim"))
+
+	err = deleteStore()
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+func TestAppHistoryRange(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	since := time.Now().UTC().Add(-time.Minute)
+	testID := uuid.New().String()
+
+	err = sendMsg(&common.Message{
+		MessageType: "topic",
+		ID:          testID,
+		PayloadType: "None",
+		Payload:     testID,
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Eventually(waitForFactID(testID, "received event")).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		ShouldNot(HaveOccurred())
+
+	b, code, err := send(http.MethodGet, historyUrl+"?since="+since.Format(time.RFC3339), nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	facts := []common.Fact{}
+	err = json.Unmarshal(b, &facts)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(facts).ShouldNot(BeEmpty())
+
+	for i := 1; i < len(facts); i++ {
+		g.Expect(facts[i].Timestamp).Should(BeNumerically(">=", facts[i-1].Timestamp))
+	}
+
+	b, code, err = send(http.MethodGet, historyUrl+"?until="+since.Format(time.RFC3339), nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	err = json.Unmarshal(b, &facts)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(facts).Should(BeEmpty())
+}
+
+func TestAppHistoryVerify(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	for i := 0; i < 2; i++ {
+		testID := uuid.New().String()
+
+		err = sendMsg(&common.Message{
+			MessageType: "topic",
+			ID:          testID,
+			PayloadType: "None",
+			Payload:     testID,
+		})
+		g.Expect(err).ShouldNot(HaveOccurred())
+
+		g.Eventually(waitForFactID(testID, "received event")).
+			WithPolling(pollingInterval).
+			WithTimeout(pollingTimeout).
+			ShouldNot(HaveOccurred())
+	}
+
+	type report struct {
+		OK     bool `json:"ok"`
+		Issues []struct {
+			Kind string `json:"kind"`
+		} `json:"issues"`
+	}
+
+	b, code, err := send(http.MethodGet, historyUrl+"/verify", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	r := &report{}
+	err = json.Unmarshal(b, r)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(r.Issues).Should(BeEmpty())
+	g.Expect(r.OK).Should(BeTrue())
+}
+
+func TestAppHistoryStats(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	testID := uuid.New().String()
+
+	err = sendMsg(&common.Message{
+		MessageType: "topic",
+		ID:          testID,
+		PayloadType: "None",
+		Payload:     testID,
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Eventually(waitForFactID(testID, "received event")).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		ShouldNot(HaveOccurred())
+
+	type stats struct {
+		Total  int `json:"total"`
+		Counts []struct {
+			Action string `json:"action"`
+			Count  int    `json:"count"`
+		} `json:"counts"`
+	}
+
+	b, code, err := send(http.MethodGet, historyUrl+"/stats", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	s := &stats{}
+	err = json.Unmarshal(b, s)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(s.Total).Should(BeNumerically(">=", 1))
+
+	received := 0
+	for _, c := range s.Counts {
+		if c.Action == "received event" {
+			received += c.Count
+		}
+	}
+
+	g.Expect(received).Should(BeNumerically(">=", 1))
+}
+
+func TestAppHistoryReconcile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	testID := uuid.New().String()
+
+	err = sendMsg(&common.Message{
+		MessageType: "topic",
+		ID:          testID,
+		PayloadType: "None",
+		Payload:     testID,
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Eventually(waitForFactID(testID, "received event")).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		ShouldNot(HaveOccurred())
+
+	// a message which failed to send is neither checked nor unmatched
+	err = sendMsg(&common.Message{MessageType: "topic", ID: uuid.New().String(), PayloadType: "None", DeliverAt: "100000h"})
+	g.Expect(err).Should(HaveOccurred())
+
+	type report struct {
+		Checked     int `json:"checked"`
+		Delivered   int `json:"delivered"`
+		Unmatched   int `json:"unmatched"`
+		Undelivered []struct {
+			ID string `json:"id"`
+		} `json:"undelivered"`
+	}
+
+	b, code, err := send(http.MethodGet, historyUrl+"/reconcile", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	r := &report{}
+	err = json.Unmarshal(b, r)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(r.Checked).Should(Equal(1))
+	g.Expect(r.Delivered).Should(Equal(1))
+	g.Expect(r.Unmatched).Should(BeZero())
+	g.Expect(r.Undelivered).Should(BeEmpty())
+}
+
+func TestAppSendBatch(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	topicID := uuid.New().String()
+	queueID := uuid.New().String()
+
+	msgs := []*common.Message{
+		{MessageType: "topic", ID: topicID, PayloadType: "None", Payload: topicID},
+		{MessageType: "queue", ID: queueID, PayloadType: "None", Payload: queueID},
+		{MessageType: "carrier-pigeon", PayloadType: "None"},
+	}
+
+	type result struct {
+		ID    string `json:"id"`
+		Sent  bool   `json:"sent"`
+		Error string `json:"error"`
+	}
+
+	b, code, err := send(http.MethodPost, sendUrl+"/batch", msgs, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).To(Equal(http.StatusMultiStatus))
+
+	results := []result{}
+	err = json.Unmarshal(b, &results)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(results).To(HaveLen(3))
+	g.Expect(results[0].Sent).To(BeTrue())
+	g.Expect(results[1].Sent).To(BeTrue())
+	g.Expect(results[2].Sent).To(BeFalse())
+	g.Expect(results[2].Error).To(ContainSubstring("unknown message type"))
+
+	// nothing in the batch was valid
+	_, code, err = send(http.MethodPost, sendUrl+"/batch", msgs[2:], nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).To(Equal(http.StatusBadRequest))
+
+	_, code, err = send(http.MethodPost, sendUrl+"/batch", []*common.Message{}, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).To(Equal(http.StatusBadRequest))
+
+	g.Eventually(waitForFactID(topicID, "received event")).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		ShouldNot(HaveOccurred())
+
+	g.Eventually(waitForFactID(queueID, "task complete")).
+		WithPolling(pollingInterval).
+		WithTimeout(10 * time.Minute).
+		ShouldNot(HaveOccurred())
+}
+
+func TestAppTopicDeliverAt(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	err = sendMsg(&common.Message{MessageType: "topic", PayloadType: "None", DeliverAt: "soon"})
+	g.Expect(err).Should(HaveOccurred())
+
+	err = sendMsg(&common.Message{MessageType: "topic", PayloadType: "None", DeliverAt: "100000h"})
+	g.Expect(err).Should(HaveOccurred())
+
+	testID := uuid.New().String()
+
+	err = sendMsg(&common.Message{
+		MessageType: "topic",
+		ID:          testID,
+		PayloadType: "None",
+		Payload:     testID,
+		DeliverAt:   time.Now().Add(10 * time.Second).UTC().Format(time.RFC3339),
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	g.Eventually(waitForFactID(testID, "received event")).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		ShouldNot(HaveOccurred())
+}
+
+func TestAppQueueDeliverAt(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	err := deleteHistory()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	err = sendMsg(&common.Message{MessageType: "queue", PayloadType: "None", DeliverAt: "100000h"})
+	g.Expect(err).Should(HaveOccurred())
+
+	testID := uuid.New().String()
+
+	err = sendMsg(&common.Message{
+		MessageType: "queue",
+		ID:          testID,
+		PayloadType: "None",
+		Payload:     testID,
+		DeliverAt:   "10s",
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	// released by the staged-delivery schedule, then consumed by the five minute schedule
+	taskComplete := waitForFactID(testID, "task complete")
+
+	g.Eventually(func() error {
+		runSchedule("staged-delivery")
+		return taskComplete()
+	}).
+		WithPolling(pollingInterval).
+		WithTimeout(15 * time.Minute).
+		ShouldNot(HaveOccurred())
+}
+
+func TestAppPayloadTypes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	b, code, err := send(http.MethodGet, baseUrl+"/payload-types", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+	g.Expect(string(b)).Should(ContainSubstring(`"name":"Ping"`))
+
+	err = sendMsg(&common.Message{MessageType: "topic", PayloadType: "Mystery", Payload: "{}"})
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("unknown payload type"))
+
+	err = sendMsg(&common.Message{MessageType: "topic", PayloadType: "Ping", Payload: `{"colour":"red"}`})
+	g.Expect(err).Should(HaveOccurred())
+
+	err = sendMsg(&common.Message{MessageType: "topic", PayloadType: "Ping", Payload: `{"note":"hello"}`})
+	g.Expect(err).ShouldNot(HaveOccurred())
+}
+
+// deadLetters lists the dead letters, keyed by ID
+func deadLetters() (map[string]common.DeadLetter, error) {
+	b, code, err := send(http.MethodGet, baseUrl+"/dlq", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if code != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", code, string(b))
+	}
+
+	dls := []common.DeadLetter{}
+	if err := json.Unmarshal(b, &dls); err != nil {
+		return nil, err
+	}
+
+	byID := map[string]common.DeadLetter{}
+	for _, dl := range dls {
+		byID[dl.ID] = dl
+	}
+
+	return byID, nil
+}
+
+func TestAppDeadLetters(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	_, code, err := send(http.MethodPost, baseUrl+"/dlq/"+uuid.New().String()+"/replay", "", nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(404))
+
+	// a Fail task fails every delivery, so it is dead lettered after DLQ_MAX_ATTEMPTS runs of the consumer
+	testID := uuid.New().String()
+	err = sendMsg(&common.Message{
+		MessageType: "queue",
+		ID:          testID,
+		PayloadType: common.PayloadTypeFail,
+		Payload:     `{"reason":"dead letter test"}`,
+	})
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	dl := common.DeadLetter{}
+
+	g.Eventually(func() error {
+		runSchedule("five-min-schedule")
+
+		dls, err := deadLetters()
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if dl, ok = dls[testID]; !ok {
+			return fmt.Errorf("task %s isn't dead lettered yet", testID)
+		}
+
+		return nil
+	}).
+		WithPolling(pollingInterval).
+		WithTimeout(10 * time.Minute).
+		ShouldNot(HaveOccurred())
+
+	g.Expect(dl.Queue).Should(Equal("work"))
+	g.Expect(dl.PayloadType).Should(Equal(common.PayloadTypeFail))
+	g.Expect(dl.Reason).Should(ContainSubstring("dead letter test"))
+	g.Expect(dl.Attempts).Should(BeNumerically(">", 0))
+
+	// replaying sends it back to the queue, removing the dead letter
+	_, code, err = send(http.MethodPost, baseUrl+"/dlq/"+testID+"/replay", "", nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(200))
+
+	dls, err := deadLetters()
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(dls).ShouldNot(HaveKey(testID))
+
+	hist, err := history()
+	g.Expect(err).ShouldNot(HaveOccurred())
+
+	replayed := false
+	for _, f := range hist {
+		if f.Source == "work-dlq" && f.Action == "replayed" && strings.Contains(f.Data, testID) {
+			replayed = true
+		}
+	}
+
+	g.Expect(replayed).Should(BeTrue())
+
+	// the replayed task is received and fails again
+	g.Eventually(func() error {
+		runSchedule("five-min-schedule")
+
+		b, code, err := send(http.MethodGet, historyUrl+"?action=dead+lettered", nil, nil)
+		if err != nil {
+			return err
+		}
+
+		if code != http.StatusOK {
+			return fmt.Errorf("unexpected status %d: %s", code, string(b))
+		}
+
+		facts := []common.Fact{}
+		if err := json.Unmarshal(b, &facts); err != nil {
+			return err
+		}
+
+		count := 0
+		for _, f := range facts {
+			if strings.Contains(f.Data, testID) {
+				count++
+			}
+		}
+
+		if count < 2 {
+			return fmt.Errorf("replayed task %s hasn't been dead lettered again yet", testID)
+		}
+
+		return nil
+	}).
+		WithPolling(pollingInterval).
+		WithTimeout(10 * time.Minute).
+		ShouldNot(HaveOccurred())
+}
+
+func TestAppSchedules(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	var b []byte
+
+	// the worker publishes its schedules when it starts
+	g.Eventually(func() (int, error) {
+		var code int
+		var err error
+
+		b, code, err = send(http.MethodGet, baseUrl+"/schedules?count=3", nil, nil)
+
+		return code, err
+	}).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		Should(Equal(200))
+
+	schedules := []map[string]interface{}{}
+	err := json.Unmarshal(b, &schedules)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(schedules).ShouldNot(BeEmpty())
+
+	crons := 0
+
+	for _, s := range schedules {
+		g.Expect(s).Should(HaveKey("description"))
+
+		if _, ok := s["cron"]; !ok {
+			continue
+		}
+
+		crons++
+
+		nextRuns := []time.Time{}
+		for _, r := range s["nextRuns"].([]interface{}) {
+			next, err := time.Parse(time.RFC3339, r.(string))
+			g.Expect(err).ShouldNot(HaveOccurred())
+
+			nextRuns = append(nextRuns, next)
+		}
+
+		g.Expect(nextRuns).Should(HaveLen(3))
+		g.Expect(nextRuns[0]).Should(BeTemporally(">", time.Now().Add(-time.Minute)))
+		g.Expect(nextRuns[1]).Should(BeTemporally(">", nextRuns[0]))
+		g.Expect(nextRuns[2]).Should(BeTemporally(">", nextRuns[1]))
+	}
+
+	// the default processed-expiry schedule is a cron schedule
+	g.Expect(crons).Should(BeNumerically(">", 0))
+
+	_, code, err := send(http.MethodGet, baseUrl+"/schedules?count=-1", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(400))
+}
+
+func TestAppScheduleRuns(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	runs := []common.JobRun{}
+
+	g.Eventually(func() error {
+		runSchedule("five-min-schedule")
+
+		b, code, err := send(http.MethodGet, baseUrl+"/schedules/runs?schedule=five-min-schedule&limit=5", nil, nil)
+		if err != nil {
+			return err
+		}
+
+		if code != 200 {
+			return fmt.Errorf("unexpected status %d: %s", code, string(b))
+		}
+
+		if err := json.Unmarshal(b, &runs); err != nil {
+			return err
+		}
+
+		if len(runs) == 0 {
+			return fmt.Errorf("no runs of five-min-schedule yet")
+		}
+
+		return nil
+	}).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeout).
+		ShouldNot(HaveOccurred())
+
+	g.Expect(len(runs)).Should(BeNumerically("<=", 5))
+	g.Expect(runs[0].Schedule).Should(Equal("five-min-schedule"))
+	g.Expect(runs[0].Job).Should(Equal("consume-queue"))
+
+	_, code, err := send(http.MethodGet, baseUrl+"/schedules/runs?limit=0", nil, nil)
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(Equal(400))
+}
+
+func TestAppJobTrigger(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// esp. in CI, wait for the API to come up.
+	g.Eventually(apiIsUp).
+		WithPolling(pollingInterval).
+		WithTimeout(pollingTimeoutAPIUp).
+		ShouldNot(HaveOccurred())
+
+	_, code, err := send(http.MethodPost, baseUrl+"/jobs/five-min-schedule/run", nil, map[string]string{"Authorization": "Bearer not-the-token"})
+	g.Expect(err).ShouldNot(HaveOccurred())
+	g.Expect(code).Should(BeElementOf(401, 403))
+
+	if jobsToken == "" {
+		t.Skip("JOBS_TOKEN is not set")
+	}
+
+	auth := map[string]string{"Authorization": "Bearer " + jobsToken}
+
+	trigger := func(name string) common.JobTrigger {
+		b, code, err := send(http.MethodPost, baseUrl+"/jobs/"+name+"/run", nil, auth)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(code).Should(Equal(202))
+
+		trigger := common.JobTrigger{}
+		err = json.Unmarshal(b, &trigger)
+		g.Expect(err).ShouldNot(HaveOccurred())
+		g.Expect(trigger.Name).Should(Equal(name))
+
+		return trigger
+	}
+
+	// waitForRun waits for the worker to finish the triggered run, recorded against the schedule
+	waitForRun := func(trigger common.JobTrigger, schedule string) common.JobRun {
+		run := common.JobRun{}
+
+		g.Eventually(func() error {
+			b, _, err := send(http.MethodGet, baseUrl+"/schedules/runs?schedule="+schedule, nil, nil)
+			if err != nil {
+				return err
+			}
+
+			runs := []common.JobRun{}
+			if err := json.Unmarshal(b, &runs); err != nil {
+				return err
+			}
+
+			for _, r := range runs {
+				if r.ID == trigger.ID && r.Trigger == common.TriggerManual && r.Status != common.JobRunning {
+					run = r
+					return nil
+				}
+			}
+
+			return fmt.Errorf("run %s not finished yet", trigger.ID)
+		}).
+			WithPolling(pollingInterval).
+			WithTimeout(pollingTimeout).
+			ShouldNot(HaveOccurred())
+
+		return run
+	}
+
+	// the worker resolves the name, recording a failed run when it is neither a schedule nor a job
+	run := waitForRun(trigger("no-such-job"), "no-such-job")
+	g.Expect(run.Status).Should(Equal(common.JobFailed))
+	g.Expect(run.Error).Should(ContainSubstring("unknown schedule or job"))
+
+	run = waitForRun(trigger("five-min-schedule"), "five-min-schedule")
+	g.Expect(run.Job).Should(Equal("consume-queue"))
+
+	run = waitForRun(trigger("release-staged"), common.ManualSchedule)
+	g.Expect(run.Job).Should(Equal("release-staged"))
+}